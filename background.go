@@ -0,0 +1,488 @@
+package goose
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// BackgroundFn processes one batch of a background migration in tx. It gets
+// the cursor returned by the previous batch, "" for the first one, and
+// returns the cursor to continue from and whether the migration is done.
+type BackgroundFn func(tx *gorm.DB, cursor string, batchSize int) (next string, done bool, err error)
+
+// Statuses of background jobs.
+const (
+	BackgroundPending = "pending"
+	BackgroundFailed  = "failed" // the last batch failed, the job is retried by the next run
+	BackgroundDone    = "done"
+)
+
+// BackgroundJob is the progress of a queued background migration.
+type BackgroundJob struct {
+	Version   int64
+	Status    string
+	Cursor    string
+	Batches   int64 // number of batches done
+	Error     string
+	UpdatedAt time.Time
+}
+
+var (
+	backgroundBatchSize = 1000
+	backgroundThrottle  = time.Duration(0)
+	backgroundLease     = time.Minute
+	backgroundWorker    = workerName()
+)
+
+// SetBackgroundBatchSize sets the batch size of background migrations that
+// don't set their own.
+func SetBackgroundBatchSize(n int) {
+	backgroundBatchSize = n
+}
+
+// SetBackgroundThrottle sets the pause between the batches of background
+// migrations that don't set their own.
+func SetBackgroundThrottle(d time.Duration) {
+	backgroundThrottle = d
+}
+
+// workerName identifies this process in the leases of background jobs.
+func workerName() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// AddBackgroundMigration adds a background migration. up only queues it;
+// RunBackground calls fn batch after batch until it reports it is done.
+// down rolls it back like the down function of a regular migration.
+func AddBackgroundMigration(service string, opts MigrationOptions, fn BackgroundFn, down MigrationFn) error {
+	_, filename, _, _ := runtime.Caller(1)
+	return AddNamedBackgroundMigration(service, filename, opts, fn, down)
+}
+
+// AddNamedBackgroundMigration : Add a named background migration.
+func AddNamedBackgroundMigration(service string, filename string, opts MigrationOptions, fn BackgroundFn, down MigrationFn) error {
+	opts.Background = true
+	if err := AddNamedMigrationWithOptions(service, filename, opts, nil, down); err != nil {
+		return err
+	}
+	v, _ := NumericComponent(filename)
+	registeredGoMigrationsByService[service][v].BatchFn = fn
+	return nil
+}
+
+// backgroundSupported fails for dialects without the transactions background
+// jobs record their progress in.
+func backgroundSupported() error {
+	if !supportsTx() {
+		return errors.Errorf("background migrations are not supported by %s", dialectName)
+	}
+	return nil
+}
+
+func backgroundTableName() string {
+	return companionTableName("_background")
+}
+
+func createBackgroundTableSQL() string {
+	if c, ok := GetDialect().(CompanionTableCreator); ok {
+		if q := c.CreateBackgroundTableSQL(backgroundTableName()); q != "" {
+			return q
+		}
+	}
+	return fmt.Sprintf(`CREATE TABLE %s (
+                service VARCHAR(100) NOT NULL,
+                version_id BIGINT NOT NULL,
+                status VARCHAR(20) NOT NULL,
+                cursor_value TEXT NULL,
+                batches BIGINT NOT NULL,
+                last_error TEXT NULL,
+                locked_by VARCHAR(255) NULL,
+                locked_until BIGINT NOT NULL,
+                updated_at BIGINT NOT NULL,
+                PRIMARY KEY (service, version_id)
+            );`, backgroundTableName())
+}
+
+// GetBackgroundJobs returns the background jobs of service in version
+// order. The jobs table is left alone: if it doesn't exist yet, no job was
+// queued.
+func GetBackgroundJobs(db *gorm.DB, service string) ([]BackgroundJob, error) {
+	q := fmt.Sprintf("SELECT version_id, status, cursor_value, batches, last_error, updated_at FROM %s WHERE service = ? ORDER BY version_id", backgroundTableName())
+	rows, err := db.Raw(q, service).Rows()
+	if err != nil {
+		if !hasTable(db, backgroundTableName()) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to query background jobs")
+	}
+	defer rows.Close()
+
+	var jobs []BackgroundJob
+	for rows.Next() {
+		var (
+			job             BackgroundJob
+			cursor, lastErr *string
+			updated         int64
+		)
+		if err := rows.Scan(&job.Version, &job.Status, &cursor, &job.Batches, &lastErr, &updated); err != nil {
+			return nil, errors.Wrap(err, "failed to scan background job")
+		}
+		if cursor != nil {
+			job.Cursor = *cursor
+		}
+		if lastErr != nil {
+			job.Error = *lastErr
+		}
+		job.UpdatedAt = time.Unix(updated, 0)
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to query background jobs")
+	}
+	return jobs, nil
+}
+
+// ensureBackgroundTable creates the jobs table if it doesn't exist yet.
+func ensureBackgroundTable(db *gorm.DB) error {
+	if hasTable(db, backgroundTableName()) {
+		return nil
+	}
+	if r := db.Exec(createBackgroundTableSQL()); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to create background jobs table")
+	}
+	return nil
+}
+
+// backgroundJob returns the job of version v of service, or nil if it was
+// never queued.
+func backgroundJob(db *gorm.DB, service string, v int64) (*BackgroundJob, error) {
+	jobs, err := GetBackgroundJobs(db, service)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		if jobs[i].Version == v {
+			return &jobs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// enqueue records a background migration as applied and queues its job,
+// unless it is queued already.
+func (m *Migration) enqueue(db *gorm.DB) error {
+	if err := backgroundSupported(); err != nil {
+		return errors.Wrapf(err, "ERROR %v", filepath.Base(m.Source))
+	}
+	job, err := backgroundJob(db, m.Service, m.Version)
+	if err != nil {
+		return errors.Wrapf(err, "ERROR %v", filepath.Base(m.Source))
+	}
+	if job == nil {
+		if err := ensureBackgroundTable(db); err != nil {
+			return errors.Wrapf(err, "ERROR %v", filepath.Base(m.Source))
+		}
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "ERROR failed to begin transaction")
+	}
+	if job == nil {
+		q := fmt.Sprintf("INSERT INTO %s (service, version_id, status, batches, locked_until, updated_at) VALUES (?, ?, ?, 0, 0, ?)", backgroundTableName())
+		if r := tx.Exec(q, m.Service, m.Version, BackgroundPending, time.Now().Unix()); r.Error != nil {
+			tx.Rollback()
+			return errors.Wrap(r.Error, "ERROR failed to queue background migration")
+		}
+	}
+	if r := tx.Exec(GetDialect().InsertVersionSQL(m.Service), m.Version, true, m.Options.Description, m.Options.Ticket, m.Options.Author); r.Error != nil {
+		tx.Rollback()
+		return errors.Wrap(r.Error, "ERROR failed to insert new goose version")
+	}
+	if r := tx.Commit(); r.Error != nil {
+		return errors.Wrap(r.Error, "ERROR failed to commit transaction")
+	}
+
+	logFor(db).Println("QUEUED", filepath.Base(m.Source))
+	return nil
+}
+
+// deleteBackgroundJob drops the job of a rolled back background migration.
+func deleteBackgroundJob(db *gorm.DB, service string, v int64) error {
+	if !hasTable(db, backgroundTableName()) {
+		return nil
+	}
+	q := deleteSQL(backgroundTableName(), "service = ? AND version_id = ?")
+	if r := db.Exec(q, service, v); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to delete background job")
+	}
+	return nil
+}
+
+// RunBackground runs the queued background migrations of service in version
+// order, batch by batch, until all are done. Every batch runs in a
+// transaction that also records the progress of the job, so a worker that
+// is stopped continues where it left off. Workers lease the jobs they run,
+// so several of them may run at once; jobs leased by another worker are
+// skipped. RunBackground stops between batches once the context of db is
+// canceled.
+func RunBackground(db *gorm.DB, service, dir string) error {
+	if err := backgroundSupported(); err != nil {
+		return err
+	}
+	migrations, err := CollectMigrations(service, dir, minVersion, maxVersion)
+	if err != nil {
+		return err
+	}
+	jobs, err := GetBackgroundJobs(db, service)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.Status == BackgroundDone {
+			continue
+		}
+		m, err := migrations.Current(job.Version)
+		if err != nil {
+			return errors.Errorf("background job of version %d has no migration in %s", job.Version, dir)
+		}
+		if err := runBackgroundJob(db, m, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchSizePlaceholder is replaced with the batch size in the statements of
+// SQL background migrations.
+const batchSizePlaceholder = "${batch_size}"
+
+// batchFn returns the function running a batch of the background migration
+// m. A batch of a SQL migration runs its Up statements, with the batch size
+// in place of ${batch_size}; it is done once the last statement affects no
+// rows.
+func (m *Migration) batchFn() (BackgroundFn, error) {
+	if filepath.Ext(m.Source) != ".sql" {
+		if m.BatchFn == nil {
+			return nil, errors.Errorf("ERROR %v: no background function registered", filepath.Base(m.Source))
+		}
+		return m.BatchFn, nil
+	}
+
+	f, err := os.Open(m.Source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(m.Source))
+	}
+	defer f.Close()
+
+	statements, _, err := parseSQLStatements(f, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ERROR %v: failed to parse SQL migration file", m.location(err))
+	}
+	return func(tx *gorm.DB, cursor string, batchSize int) (string, bool, error) {
+		var affected int64
+		for i, stmt := range statements {
+			r := tx.Exec(strings.Replace(stmt.SQL, batchSizePlaceholder, strconv.Itoa(batchSize), -1))
+			if r.Error != nil {
+				return cursor, false, statementError(i, stmt, r.Error)
+			}
+			affected = r.RowsAffected
+		}
+		return cursor, affected == 0, nil
+	}, nil
+}
+
+func runBackgroundJob(db *gorm.DB, m *Migration, job BackgroundJob) error {
+	name := filepath.Base(m.Source)
+	if err := m.loadOptions(); err != nil {
+		return errors.Wrapf(err, "ERROR %v: failed to parse SQL migration file", name)
+	}
+	fn, err := m.batchFn()
+	if err != nil {
+		return err
+	}
+
+	claimed, err := leaseBackgroundJob(db, m.Service, m.Version)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		logFor(db).Printf("goose: %s is run by another worker\n", name)
+		return nil
+	}
+	defer releaseBackgroundJob(db, m.Service, m.Version)
+	defer renewBackgroundLease(db, m.Service, m.Version)()
+
+	batchSize := m.Options.BatchSize
+	if batchSize <= 0 {
+		batchSize = backgroundBatchSize
+	}
+	throttle := m.Options.Throttle
+	if throttle <= 0 {
+		throttle = backgroundThrottle
+	}
+
+	ctx := db.Statement.Context
+	cursor, batches := job.Cursor, job.Batches
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tx := db.Begin()
+		if tx.Error != nil {
+			return errors.Wrap(tx.Error, "ERROR failed to begin transaction")
+		}
+		next, done, err := fn(tx, cursor, batchSize)
+		if err != nil {
+			tx.Rollback()
+			failBackgroundJob(db, m.Service, m.Version, err)
+			return errors.Wrapf(err, "ERROR %v: batch %d failed", name, batches+1)
+		}
+
+		status := BackgroundPending
+		if done {
+			status = BackgroundDone
+		}
+		now := time.Now()
+		q := fmt.Sprintf("UPDATE %s SET status = ?, cursor_value = ?, batches = batches + 1, last_error = NULL, locked_until = ?, updated_at = ? WHERE service = ? AND version_id = ? AND locked_by = ?", backgroundTableName())
+		r := tx.Exec(q, status, next, now.Add(backgroundLease).UnixNano(), now.Unix(), m.Service, m.Version, backgroundWorker)
+		if r.Error != nil {
+			tx.Rollback()
+			return errors.Wrapf(r.Error, "ERROR %v: failed to record progress", name)
+		}
+		if r.RowsAffected == 0 {
+			tx.Rollback()
+			return errors.Errorf("ERROR %v: lost the lease of the job to another worker", name)
+		}
+		if r := tx.Commit(); r.Error != nil {
+			return errors.Wrap(r.Error, "ERROR failed to commit transaction")
+		}
+
+		cursor, batches = next, batches+1
+		if done {
+			logFor(db).Printf("DONE  %s after %d batches\n", name, batches)
+			return nil
+		}
+		verboseInfo("Batch %d of %s done", batches, name)
+
+		if throttle > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(throttle):
+			}
+		}
+	}
+}
+
+// leaseBackgroundJob makes this process the worker of a job, unless another
+// worker holds a lease on it that hasn't expired.
+func leaseBackgroundJob(db *gorm.DB, service string, v int64) (bool, error) {
+	now := time.Now()
+	q := fmt.Sprintf("UPDATE %s SET locked_by = ?, locked_until = ? WHERE service = ? AND version_id = ? AND status <> ? AND (locked_by IS NULL OR locked_by = ? OR locked_until < ?)", backgroundTableName())
+	r := db.Exec(q, backgroundWorker, now.Add(backgroundLease).UnixNano(), service, v, BackgroundDone, backgroundWorker, now.UnixNano())
+	if r.Error != nil {
+		return false, errors.Wrap(r.Error, "failed to lease background job")
+	}
+	return r.RowsAffected == 1, nil
+}
+
+// renewBackgroundLease extends the lease of a job three times per lease
+// period, so it doesn't expire during a long batch, until the returned
+// function is called.
+func renewBackgroundLease(db *gorm.DB, service string, v int64) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(backgroundLease / 3)
+		defer ticker.Stop()
+		q := fmt.Sprintf("UPDATE %s SET locked_until = ? WHERE service = ? AND version_id = ? AND locked_by = ?", backgroundTableName())
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r := db.Exec(q, time.Now().Add(backgroundLease).UnixNano(), service, v, backgroundWorker)
+				switch {
+				case r.Error != nil:
+					logFor(db).Printf("goose: failed to renew the lease of background job %d: %v\n", v, r.Error)
+				case r.RowsAffected == 0:
+					logFor(db).Printf("goose: lost the lease of background job %d\n", v)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func releaseBackgroundJob(db *gorm.DB, service string, v int64) {
+	q := fmt.Sprintf("UPDATE %s SET locked_by = NULL, locked_until = 0 WHERE service = ? AND version_id = ? AND locked_by = ?", backgroundTableName())
+	if r := db.Exec(q, service, v, backgroundWorker); r.Error != nil {
+		logFor(db).Printf("goose: failed to release background job: %v\n", r.Error)
+	}
+}
+
+func failBackgroundJob(db *gorm.DB, service string, v int64, err error) {
+	q := fmt.Sprintf("UPDATE %s SET status = ?, last_error = ?, updated_at = ? WHERE service = ? AND version_id = ? AND locked_by = ?", backgroundTableName())
+	if r := db.Exec(q, BackgroundFailed, err.Error(), time.Now().Unix(), service, v, backgroundWorker); r.Error != nil {
+		logFor(db).Printf("goose: failed to record background job failure: %v\n", r.Error)
+	}
+}
+
+// unmetBackgroundRequirement fails unless the background migrations m
+// requires are done.
+func unmetBackgroundRequirement(db *gorm.DB, m *Migration) (unmet error, err error) {
+	for _, v := range m.Options.RequiresBackground {
+		job, err := backgroundJob(db, m.Service, v)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case job == nil:
+			return errors.Errorf("%v requires background migration %d to be done, but it was never queued", filepath.Base(m.Source), v), nil
+		case job.Status != BackgroundDone:
+			return errors.Errorf("%v requires background migration %d to be done, but it is %s after %d batches", filepath.Base(m.Source), v, job.Status, job.Batches), nil
+		}
+	}
+	return nil, nil
+}
+
+// BackgroundStatus prints the progress of the background jobs of service.
+func BackgroundStatus(db *gorm.DB, service string) error {
+	if err := backgroundSupported(); err != nil {
+		return err
+	}
+	jobs, err := GetBackgroundJobs(db, service)
+	if err != nil {
+		return err
+	}
+
+	logFor(db).Println("    Version         Status   Batches  Updated At")
+	logFor(db).Println("    ================================================")
+	for _, job := range jobs {
+		logFor(db).Printf("    %-15d %-8s %7d  %s\n", job.Version, job.Status, job.Batches, job.UpdatedAt.Format(time.ANSIC))
+		if job.Error != "" {
+			logFor(db).Printf("        %s\n", job.Error)
+		}
+	}
+	return nil
+}
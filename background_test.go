@@ -0,0 +1,237 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestBackgroundSQLMigration(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_users.sql": `-- +goose Up
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, upper_name TEXT);
+INSERT INTO users (name) VALUES ('a'), ('b'), ('c'), ('d'), ('e');
+
+-- +goose Down
+DROP TABLE users;
+`,
+		"00002_backfill.sql": `-- +goose BACKGROUND
+-- +goose BatchSize: 2
+-- +goose Up
+UPDATE users SET upper_name = UPPER(name) WHERE id IN (SELECT id FROM users WHERE upper_name IS NULL LIMIT ${batch_size});
+
+-- +goose Down
+`,
+		"00003_not_null.sql": `-- +goose RequiresBackground: 2
+-- +goose Up
+CREATE TABLE checked (id INTEGER PRIMARY KEY);
+
+-- +goose Down
+DROP TABLE checked;
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := openMemoryDB(t)
+
+	err = Up(db, "test", dir)
+	if err == nil || !strings.Contains(err.Error(), "requires background migration 2 to be done, but it is pending") {
+		t.Fatalf("expected the unfinished background migration to stop up, got %v", err)
+	}
+	if version, err := GetDBVersion(db, "test"); err != nil || version != 2 {
+		t.Fatalf("expected the background migration to be queued at version 2, got %d, %v", version, err)
+	}
+
+	if err := RunBackground(db, "test", dir); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := GetBackgroundJobs(db, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three batches update 2, 2 and 1 rows, the fourth finds none left.
+	if len(jobs) != 1 || jobs[0].Status != BackgroundDone || jobs[0].Batches != 4 {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+	var missing int64
+	if r := db.Raw("SELECT COUNT(*) FROM users WHERE upper_name IS NULL OR upper_name <> UPPER(name)").Scan(&missing); r.Error != nil || missing != 0 {
+		t.Fatalf("expected all rows to be backfilled, %d are not, %v", missing, r.Error)
+	}
+
+	if err := Up(db, "test", dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackgroundGoMigrationResumes(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openMemoryDB(t)
+	if r := db.Exec("CREATE TABLE counters (n INTEGER)"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	// Counts to 10 in batches, failing once at 6.
+	failed := false
+	fn := func(tx *gorm.DB, cursor string, batchSize int) (string, bool, error) {
+		n, _ := strconv.Atoi(cursor)
+		for i := n + 1; i <= n+batchSize && i <= 10; i++ {
+			if i == 6 && !failed {
+				failed = true
+				return cursor, false, errors.New("transient failure")
+			}
+			if r := tx.Exec("INSERT INTO counters (n) VALUES (?)", i); r.Error != nil {
+				return cursor, false, r.Error
+			}
+		}
+		n += batchSize
+		return strconv.Itoa(n), n >= 10, nil
+	}
+	service := "background-go"
+	if err := AddNamedBackgroundMigration(service, "00001_count.go", MigrationOptions{BatchSize: 3}, fn, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(registeredGoMigrationsByService, service)
+
+	if err := Up(db, service, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunBackground(db, service, dir); err == nil {
+		t.Fatal("expected the failing batch to stop the worker")
+	}
+	jobs, err := GetBackgroundJobs(db, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Status != BackgroundFailed || jobs[0].Cursor != "3" || !strings.Contains(jobs[0].Error, "transient failure") {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	// The next run continues after the last recorded batch.
+	if err := RunBackground(db, service, dir); err != nil {
+		t.Fatal(err)
+	}
+	var count, sum int64
+	if r := db.Raw("SELECT COUNT(*), SUM(n) FROM counters").Row().Scan(&count, &sum); r != nil || count != 10 || sum != 55 {
+		t.Fatalf("expected 1 to 10 counted once, got %d rows summing to %d, %v", count, sum, r)
+	}
+}
+
+func TestBackgroundLeaseRenewed(t *testing.T) {
+	// Changes the dialect and the lease, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	defer func(lease time.Duration) { backgroundLease = lease }(backgroundLease)
+	backgroundLease = 60 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A file database, so the lease can be renewed while a batch runs.
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "lease.db")+"?_busy_timeout=5000"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	// The only batch outlasts the lease several times over.
+	var expired time.Duration
+	fn := func(tx *gorm.DB, cursor string, batchSize int) (string, bool, error) {
+		time.Sleep(4 * backgroundLease)
+		var lockedUntil int64
+		q := "SELECT locked_until FROM " + backgroundTableName() + " WHERE service = ?"
+		if r := db.Raw(q, "background-lease").Scan(&lockedUntil); r.Error != nil {
+			return cursor, false, r.Error
+		}
+		expired = time.Duration(time.Now().UnixNano() - lockedUntil)
+		return cursor, true, nil
+	}
+	service := "background-lease"
+	if err := AddNamedBackgroundMigration(service, "00001_slow.go", MigrationOptions{}, fn, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(registeredGoMigrationsByService, service)
+
+	if err := Up(db, service, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunBackground(db, service, dir); err != nil {
+		t.Fatal(err)
+	}
+	if expired > 0 {
+		t.Fatalf("the lease expired %v before the end of the batch", expired)
+	}
+}
+
+func TestGetBackgroundJobs(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	db := openMemoryDB(t)
+
+	// Reading the jobs doesn't create the jobs table.
+	if jobs, err := GetBackgroundJobs(db, "test"); err != nil || jobs != nil {
+		t.Fatalf("expected no jobs, got %+v, %v", jobs, err)
+	}
+	if err := BackgroundStatus(db, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if hasTable(db, backgroundTableName()) {
+		t.Fatal("reading the jobs created the jobs table")
+	}
+
+	// Other errors than a missing table are returned.
+	if r := db.Exec("CREATE TABLE " + backgroundTableName() + " (service TEXT)"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if _, err := GetBackgroundJobs(db, "test"); err == nil || !strings.Contains(err.Error(), "failed to query background jobs") {
+		t.Fatalf("expected a query error, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `dir: ./migrations
+table: versions
+service: billing
+environments:
+  dev:
+    driver: sqlite3
+    dsn: ./dev.db
+  prod:
+    driver: postgres
+    dsn: postgres://goose:${GOOSE_TEST_PASSWORD}@db/billing
+    dir: ./migrations/prod
+    service: billing-prod
+`
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "goosecfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "goose.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv sets the environment variable key to value, or unsets it if value
+// is empty, until the end of the test.
+func setenv(t *testing.T, key, value string) {
+	prev, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setenv(t, "GOOSE_TEST_PASSWORD", "secret")
+
+	c, err := loadConfig(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := c.environment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.DSN != "postgres://goose:secret@db/billing" {
+		t.Errorf("unexpected DSN %q", env.DSN)
+	}
+	if _, err := c.environment("staging"); err == nil || !strings.Contains(err.Error(), "must be one of: dev, prod") {
+		t.Errorf("expected an unknown environment error, got %v", err)
+	}
+
+	for _, content := range []string{"dri: ./migrations\n", "environments:\n  dev:\n"} {
+		if _, err := loadConfig(writeConfig(t, content)); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	// Changes the flag values, so not parallel.
+	defer func(d, s, tb string) { *dir, *service, *table = d, s, tb }(*dir, *service, *table)
+	setenv(t, "GOOSE_TEST_PASSWORD", "")
+
+	c, err := loadConfig(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name     string
+		env      string
+		set      map[string]string // flags given on the command line
+		vars     [2]string         // GOOSE_DRIVER and GOOSE_DBSTRING
+		args     []string
+		wantArgs []string
+		wantDir  string
+		wantSvc  string
+	}{
+		{
+			name:     "file defaults",
+			args:     []string{"sqlite3", "./x.db", "up"},
+			wantArgs: []string{"sqlite3", "./x.db", "up"},
+			wantDir:  "./migrations",
+			wantSvc:  "billing",
+		},
+		{
+			name:     "environment overrides file",
+			env:      "prod",
+			args:     []string{"status"},
+			wantArgs: []string{"postgres", "postgres://goose:@db/billing", "status"},
+			wantDir:  "./migrations/prod",
+			wantSvc:  "billing-prod",
+		},
+		{
+			name:     "flags override environment",
+			env:      "prod",
+			set:      map[string]string{"dir": "./mine", "service": "mine"},
+			args:     []string{"status"},
+			wantArgs: []string{"postgres", "postgres://goose:@db/billing", "status"},
+			wantDir:  "./mine",
+			wantSvc:  "mine",
+		},
+		{
+			name:     "variables without environment",
+			vars:     [2]string{"mysql", "user@/db"},
+			args:     []string{"up"},
+			wantArgs: []string{"mysql", "user@/db", "up"},
+			wantDir:  "./migrations",
+			wantSvc:  "billing",
+		},
+		{
+			name:     "environment takes precedence over variables as a unit",
+			env:      "dev",
+			vars:     [2]string{"", "postgres://elsewhere"},
+			args:     []string{"up"},
+			wantArgs: []string{"sqlite3", "./dev.db", "up"},
+			wantDir:  "./migrations",
+			wantSvc:  "billing",
+		},
+	}
+	for _, test := range tt {
+		*dir, *service, *table = ".", "default", "goose_db_version"
+		set := make(map[string]bool)
+		for name, value := range test.set {
+			set[name] = true
+			switch name {
+			case "dir":
+				*dir = value
+			case "service":
+				*service = value
+			}
+		}
+		setenv(t, envGooseDriver, test.vars[0])
+		setenv(t, envGooseDBString, test.vars[1])
+
+		env, err := c.apply(test.env, set)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if args := mergeArgs(test.args, env); !reflect.DeepEqual(args, test.wantArgs) {
+			t.Errorf("%s: got args %q, want %q", test.name, args, test.wantArgs)
+		}
+		if *dir != test.wantDir || *service != test.wantSvc || *table != "versions" {
+			t.Errorf("%s: got dir %q, service %q and table %q", test.name, *dir, *service, *table)
+		}
+	}
+}
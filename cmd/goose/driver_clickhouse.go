@@ -3,5 +3,10 @@
 package main
 
 import (
-	_ "github.com/ClickHouse/clickhouse-go"
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/driver/clickhouse"
 )
+
+func init() {
+	goose.RegisterDriver("clickhouse", clickhouse.Open, "clickhouse")
+}
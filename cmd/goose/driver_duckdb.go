@@ -0,0 +1,30 @@
+// +build !no_duckdb,cgo
+
+package main
+
+import (
+	_ "github.com/marcboeker/go-duckdb"
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func init() {
+	goose.RegisterDriver("duckdb", openDuckDB, "duckdb")
+}
+
+// duckdbDialector runs gorm on the duckdb database/sql driver. DuckDB takes
+// Postgres style $1 placeholders, so the postgres dialector does the rest.
+type duckdbDialector struct {
+	gorm.Dialector
+}
+
+func (duckdbDialector) Name() string {
+	return "duckdb"
+}
+
+// openDuckDB opens the DuckDB file at dsn, or an in-memory database if dsn
+// is empty.
+func openDuckDB(dsn string) gorm.Dialector {
+	return duckdbDialector{postgres.New(postgres.Config{DriverName: "duckdb", DSN: dsn})}
+}
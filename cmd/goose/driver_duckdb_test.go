@@ -0,0 +1,32 @@
+// +build !no_duckdb,cgo
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ottomillrath/goose/v2"
+	"github.com/ottomillrath/goose/v2/goosetest"
+	"gorm.io/gorm"
+)
+
+func openTestDuckDB(t *testing.T) *gorm.DB {
+	db, err := goose.OpenDBWithDriver("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestDuckDBDialect(t *testing.T) {
+	goosetest.RunDialectTests(t, openTestDuckDB(t), "duckdb")
+}
+
+func TestDuckDBRoundTrip(t *testing.T) {
+	goosetest.RoundTrip(t, openTestDuckDB(t), "default", "../../examples/sql-migrations")
+}
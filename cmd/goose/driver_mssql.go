@@ -3,5 +3,10 @@
 package main
 
 import (
-	_ "github.com/denisenkom/go-mssqldb"
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/driver/sqlserver"
 )
+
+func init() {
+	goose.RegisterDriver("mssql", sqlserver.Open, "mssql")
+}
@@ -5,14 +5,46 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"regexp"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/ottomillrath/goose/v2"
+	gormmysql "gorm.io/driver/mysql"
 )
 
+func init() {
+	goose.RegisterDriver("mysql", gormmysql.Open, "mysql")
+	goose.RegisterDriver("tidb", gormmysql.Open, "tidb")
+
+	goose.RegisterDialect("mysql", &goose.MySQLDialect{Retry: mysqlRetry{}})
+	goose.RegisterDialect("tidb", &goose.TiDBDialect{Retry: mysqlRetry{tidb: true}})
+}
+
+// mysqlRetry retries migrations failing with the errors of the mysql driver
+// for deadlocks and lock wait timeouts, and on TiDB for the write conflicts
+// of optimistic transactions.
+type mysqlRetry struct {
+	tidb bool
+}
+
+func (r mysqlRetry) IsRetryable(err error) bool {
+	var e *mysql.MySQLError
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Number {
+	case 1213, 1205:
+		return true
+	case 9007:
+		return r.tidb
+	}
+	return false
+}
+
 // normalizeMySQLDSN parses the dsn used with the mysql driver to always have
 // the parameter `parseTime` set to true. This allows internal goose logic
 // to assume that DATETIME/DATE/TIMESTAMP can be scanned into the time.Time
@@ -0,0 +1,38 @@
+// +build !no_mysql
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ottomillrath/goose/v2"
+)
+
+func TestMySQLRetryable(t *testing.T) {
+	tt := []struct {
+		dialect string
+		number  uint16
+		want    bool
+	}{
+		{"mysql", 1213, true},
+		{"mysql", 9007, false},
+		{"tidb", 9007, true},
+		{"tidb", 1062, false},
+	}
+	for _, test := range tt {
+		if err := goose.SetDialect(test.dialect); err != nil {
+			t.Fatal(err)
+		}
+		classifier, ok := goose.GetDialect().(goose.RetryClassifier)
+		if !ok {
+			t.Fatalf("%s dialect %T doesn't classify errors", test.dialect, goose.GetDialect())
+		}
+		err := fmt.Errorf("failed to run SQL migration: %w", &mysql.MySQLError{Number: test.number})
+		if got := classifier.IsRetryable(err); got != test.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", test.dialect, err, got, test.want)
+		}
+	}
+	goose.SetDialect("postgres")
+}
@@ -3,5 +3,37 @@
 package main
 
 import (
-	_ "github.com/lib/pq"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/driver/postgres"
 )
+
+func init() {
+	goose.RegisterDriver("postgres", postgres.Open, "postgres")
+	goose.RegisterDriver("redshift", postgres.Open, "redshift")
+	goose.RegisterDriver("cockroach", postgres.Open, "cockroach")
+
+	goose.RegisterDialect("postgres", postgresDialect{})
+}
+
+// postgresDialect streams the data of COPY ... FROM stdin blocks with the
+// COPY protocol of pgx, which the postgres driver connects with.
+type postgresDialect struct {
+	goose.PostgresDialect
+}
+
+func (postgresDialect) CopyFrom(ctx context.Context, conn *sql.Conn, query string, data io.Reader) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs a pgx connection, got %T", driverConn)
+		}
+		_, err := c.Conn().PgConn().CopyFrom(ctx, data, query)
+		return err
+	})
+}
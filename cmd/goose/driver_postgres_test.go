@@ -0,0 +1,40 @@
+// +build !no_postgres,!no_sqlite3
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/gorm"
+)
+
+func TestTenantsDialect(t *testing.T) {
+	if err := goose.SetDialect("postgres"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := goose.GetDialect().(postgresDialect); !ok {
+		t.Fatalf("postgres dialect is %T, want the registered postgresDialect", goose.GetDialect())
+	}
+
+	// No postgres server is needed to get past the dialect check: the
+	// tenant source is asked for the schemas right after it.
+	db, err := goose.OpenDB("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	errTenants := errors.New("tenant source called")
+	opts := goose.TenantOptions{
+		Tenants: func(*gorm.DB) ([]string, error) { return nil, errTenants },
+	}
+	if _, err := goose.RunTenants("status", db, "default", "../../examples/sql-migrations", opts); err != errTenants {
+		t.Fatalf("RunTenants with the registered postgres dialect: got %v, want %v", err, errTenants)
+	}
+}
@@ -3,5 +3,10 @@
 package main
 
 import (
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/driver/sqlite"
 )
+
+func init() {
+	goose.RegisterDriver("sqlite3", sqlite.Open, "sqlite3")
+}
@@ -3,10 +3,20 @@ module github.com/ottomillrath/goose/cmd/goose
 go 1.16
 
 require (
-	github.com/ClickHouse/clickhouse-go v1.4.3
-	github.com/denisenkom/go-mssqldb v0.10.0
+	github.com/denisenkom/go-mssqldb v0.10.0 // indirect
 	github.com/go-sql-driver/mysql v1.6.0
-	github.com/lib/pq v1.10.0
-	github.com/mattn/go-sqlite3 v1.14.7
+	github.com/jackc/pgx/v4 v4.11.0
+	github.com/lib/pq v1.10.0 // indirect
+	github.com/marcboeker/go-duckdb v1.5.6
+	github.com/mattn/go-sqlite3 v1.14.7 // indirect
 	github.com/ottomillrath/goose/v2 v2.8.1
+	gopkg.in/yaml.v2 v2.4.0
+	gorm.io/driver/clickhouse v0.1.0
+	gorm.io/driver/mysql v1.1.0
+	gorm.io/driver/postgres v1.1.0
+	gorm.io/driver/sqlite v1.1.4
+	gorm.io/driver/sqlserver v1.0.7
+	gorm.io/gorm v1.21.9
 )
+
+replace github.com/ottomillrath/goose/v2 => ../..
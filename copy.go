@@ -0,0 +1,216 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// copyDataEnd ends the data of a COPY ... FROM stdin block.
+const copyDataEnd = `\.`
+
+// matchCopyFromStdin matches the first line of a COPY ... FROM stdin block
+// and captures the table and the column list.
+var matchCopyFromStdin = regexp.MustCompile(`(?i)^\s*COPY\s+(.+?)\s*(\([^)]*\))?\s+FROM\s+stdin\s*;?\s*$`)
+
+// copyInsertParams bounds the number of parameters of the INSERT statements
+// COPY data is loaded with when the dialect isn't a Copier.
+const copyInsertParams = 500
+
+// Copier is implemented by dialects whose driver can stream the data of
+// COPY ... FROM stdin blocks with the COPY protocol. CopyFrom runs query,
+// a 'COPY ... FROM stdin' statement, on conn and sends it the tab-separated
+// rows of data. conn has the migration's transaction open, if any.
+//
+// Without a Copier, goose loads the rows with batched INSERT statements.
+type Copier interface {
+	CopyFrom(ctx context.Context, conn *sql.Conn, query string, data io.Reader) error
+}
+
+// copyBlock is a COPY ... FROM stdin statement of a migration.
+type copyBlock struct {
+	query   string // the COPY statement, without semicolon
+	table   string
+	columns string // column list in parentheses, may be empty
+	rows    []string
+}
+
+// parseCopyBlock returns the COPY block making up statement, if it is one.
+func parseCopyBlock(statement string) (*copyBlock, bool) {
+	lines := strings.Split(strings.TrimSpace(statement), "\n")
+	m := matchCopyFromStdin.FindStringSubmatch(lines[0])
+	if m == nil || len(lines) < 2 || strings.TrimSpace(lines[len(lines)-1]) != copyDataEnd {
+		return nil, false
+	}
+	return &copyBlock{
+		query:   strings.TrimSuffix(strings.TrimSpace(lines[0]), ";"),
+		table:   m[1],
+		columns: m[2],
+		rows:    lines[1 : len(lines)-1],
+	}, true
+}
+
+// hasCopyBlock reports whether any of statements is a COPY block.
+func hasCopyBlock(statements []sqlStatement) bool {
+	for _, stmt := range statements {
+		if _, ok := parseCopyBlock(stmt.SQL); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// execStatement runs a statement of a SQL migration. The rows of COPY
+// blocks are streamed on conn if the dialect is a Copier and conn isn't nil,
+// and inserted otherwise.
+func execStatement(db *gorm.DB, conn *sql.Conn, statement string) error {
+	block, ok := parseCopyBlock(statement)
+	if !ok {
+		return db.Exec(statement).Error
+	}
+
+	if copier, ok := GetDialect().(Copier); ok && conn != nil {
+		data := strings.Join(block.rows, "\n") + "\n"
+		verboseInfo("Copying %d rows into %s", len(block.rows), block.table)
+		return copier.CopyFrom(db.Statement.Context, conn, block.query, strings.NewReader(data))
+	}
+	return block.insert(db)
+}
+
+// insert loads the rows of the block with batched INSERT statements.
+func (b *copyBlock) insert(db *gorm.DB) error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, len(b.rows))
+	for i, row := range b.rows {
+		fields, err := decodeCopyRow(row)
+		if err != nil {
+			return errors.Wrapf(err, "COPY data row %d", i+1)
+		}
+		if i > 0 && len(fields) != len(rows[0]) {
+			return errors.Errorf("COPY data row %d: got %d columns, want %d", i+1, len(fields), len(rows[0]))
+		}
+		rows[i] = fields
+	}
+
+	width := len(rows[0])
+	batch := copyInsertParams / width
+	if batch < 1 {
+		batch = 1
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", width), ", ") + ")"
+
+	verboseInfo("Inserting %d rows into %s", len(rows), b.table)
+	for start := 0; start < len(rows); start += batch {
+		end := start + batch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*width)
+		for _, row := range rows[start:end] {
+			values = append(values, placeholders)
+			args = append(args, row...)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s %s VALUES %s", b.table, b.columns, strings.Join(values, ", "))
+		if r := db.Exec(query, args...); r.Error != nil {
+			return r.Error
+		}
+	}
+	return nil
+}
+
+// decodeCopyRow splits a row of COPY text format into its fields. \N is
+// NULL and backslash escapes are decoded.
+func decodeCopyRow(row string) ([]interface{}, error) {
+	var fields []interface{}
+	for _, field := range strings.Split(row, "\t") {
+		if field == `\N` {
+			fields = append(fields, nil)
+			continue
+		}
+		value, err := unescapeCopyField(field)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, value)
+	}
+	return fields, nil
+}
+
+// unescapeCopyField decodes the backslash escapes of a COPY text field.
+func unescapeCopyField(field string) (string, error) {
+	if !strings.Contains(field, `\`) {
+		return field, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = field[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			// One or two hex digits.
+			j := i + 1
+			for j < len(field) && j < i+3 && isHexDigit(field[j]) {
+				j++
+			}
+			if j == i+1 {
+				b.WriteByte(c)
+				continue
+			}
+			n, err := strconv.ParseUint(field[i+1:j], 16, 8)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid escape in %q", field)
+			}
+			b.WriteByte(byte(n))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// One to three octal digits.
+			j := i + 1
+			for j < len(field) && j < i+3 && field[j] >= '0' && field[j] <= '7' {
+				j++
+			}
+			n, err := strconv.ParseUint(field[i:j], 8, 8)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid escape in %q", field)
+			}
+			b.WriteByte(byte(n))
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,71 @@
+package goose
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCopyRow(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		row  string
+		want []interface{}
+	}{
+		{"1\tadmin\tlogentry", []interface{}{"1", "admin", "logentry"}},
+		{"2\t\\N\t", []interface{}{"2", nil, ""}},
+		{`a\tb\\c\nd`, []interface{}{"a\tb\\c\nd"}},
+		{`\101\x42\x4a\z`, []interface{}{"ABJz"}},
+	}
+	for _, test := range tt {
+		got, err := decodeCopyRow(test.row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("decodeCopyRow(%q) = %q, want %q", test.row, got, test.want)
+		}
+	}
+}
+
+func TestCopyWithInserts(t *testing.T) {
+	t.Parallel()
+
+	db := openMemoryDB(t)
+
+	statements, _, err := parseSQLMigration(strings.NewReader(copyFromStdinUnannotated), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range statements {
+		if err := execStatement(db, nil, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := db.Raw("SELECT id, app_label, model FROM django_content_type ORDER BY id").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var id int
+		var label string
+		var model sql.NullString
+		if err := rows.Scan(&id, &label, &model); err != nil {
+			t.Fatal(err)
+		}
+		if !model.Valid {
+			model.String = "NULL"
+		}
+		got = append(got, strings.Join([]string{label, model.String}, "|"))
+	}
+	want := []string{"admin|logentry", "auth|permission", "contrib|NULL", "tab\there|-- not a comment"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected rows, got %q, want %q", got, want)
+	}
+}
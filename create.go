@@ -2,8 +2,12 @@ package goose
 
 import (
 	"fmt"
+	"go/parser"
+	"go/token"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"text/template"
 	"time"
 
@@ -15,10 +19,15 @@ type tmplVars struct {
 	Service   string
 	Version   string
 	CamelName string
+	SnakeName string
+	Package   string
+	Author    string
+	CreatedAt time.Time
 }
 
 var (
-	sequential = false
+	sequential  = false
+	templateDir = ""
 )
 
 // SetSequential set whether to use sequential versioning instead of timestamp based versioning
@@ -26,6 +35,12 @@ func SetSequential(s bool) {
 	sequential = s
 }
 
+// SetTemplateDir sets the directory holding custom sql.tmpl and go.tmpl
+// migration templates. Missing files fall back to the built-in templates.
+func SetTemplateDir(dir string) {
+	templateDir = dir
+}
+
 // Create writes a new blank migration file.
 func CreateWithTemplate(db *gorm.DB, service, dir string, tmpl *template.Template, name, migrationType string) error {
 	var version string
@@ -52,10 +67,9 @@ func CreateWithTemplate(db *gorm.DB, service, dir string, tmpl *template.Templat
 	filename := fmt.Sprintf("%v_%v.%v", version, snakeCase(name), migrationType)
 
 	if tmpl == nil {
-		if migrationType == "go" {
-			tmpl = goSQLMigrationTemplate
-		} else {
-			tmpl = sqlMigrationTemplate
+		var err error
+		if tmpl, err = loadTemplate(templateDir, migrationType); err != nil {
+			return err
 		}
 	}
 
@@ -74,6 +88,10 @@ func CreateWithTemplate(db *gorm.DB, service, dir string, tmpl *template.Templat
 		Service:   service,
 		Version:   version,
 		CamelName: camelCase(name),
+		SnakeName: snakeCase(name),
+		Package:   packageName(dir),
+		Author:    gitAuthor(),
+		CreatedAt: time.Now(),
 	}
 	if err := tmpl.Execute(f, vars); err != nil {
 		return errors.Wrap(err, "failed to execute tmpl")
@@ -88,6 +106,64 @@ func Create(db *gorm.DB, service, dir, name, migrationType string) error {
 	return CreateWithTemplate(db, service, dir, nil, name, migrationType)
 }
 
+// loadTemplate returns the template for the given migration type, preferring
+// <dir>/<type>.tmpl over the built-in one when dir is set.
+func loadTemplate(dir, migrationType string) (*template.Template, error) {
+	if dir != "" {
+		path := filepath.Join(dir, migrationType+".tmpl")
+		if _, err := os.Stat(path); err == nil {
+			tmpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse template %s", path)
+			}
+			return tmpl, nil
+		} else if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to read template %s", path)
+		}
+	}
+
+	if migrationType == "go" {
+		return goSQLMigrationTemplate, nil
+	}
+	return sqlMigrationTemplate, nil
+}
+
+// packageName infers the Go package name for a new migration in dir, using
+// the package clause of an existing Go file or else the directory name.
+func packageName(dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+		if err == nil {
+			return f.Name.Name
+		}
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "migrations"
+	}
+	name := strings.Trim(snakeCase(filepath.Base(abs)), "_")
+	if name == "" || !token.IsIdentifier(name) || token.IsKeyword(name) {
+		return "migrations"
+	}
+	return name
+}
+
+// gitAuthor returns the configured git user name, falling back to $USER.
+func gitAuthor() string {
+	out, err := exec.Command("git", "config", "user.name").Output()
+	if err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return name
+		}
+	}
+	return os.Getenv("USER")
+}
+
 var sqlMigrationTemplate = template.Must(template.New("goose.sql-migration").Parse(`-- +goose Up
 -- +goose StatementBegin
 SELECT 'up SQL query';
@@ -99,23 +175,23 @@ SELECT 'down SQL query';
 -- +goose StatementEnd
 `))
 
-var goSQLMigrationTemplate = template.Must(template.New("goose.go-migration").Parse(`package migrations
+var goSQLMigrationTemplate = template.Must(template.New("goose.go-migration").Parse(`package {{.Package}}
 
 import (
-	"database/sql"
 	"github.com/ottomillrath/goose/v2"
+	"gorm.io/gorm"
 )
 
 func init() {
 	goose.AddMigration("{{.Service}}", up{{.CamelName}}, down{{.CamelName}})
 }
 
-func up{{.CamelName}}(tx *sql.Tx) error {
+func up{{.CamelName}}(tx *gorm.DB) error {
 	// This code is executed when the migration is applied.
 	return nil
 }
 
-func down{{.CamelName}}(tx *sql.Tx) error {
+func down{{.CamelName}}(tx *gorm.DB) error {
 	// This code is executed when the migration is rolled back.
 	return nil
 }
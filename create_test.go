@@ -2,9 +2,15 @@ package goose
 
 import (
 	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -21,8 +27,8 @@ func TestSequential(t *testing.T) {
 	defer os.RemoveAll(dir)               // clean up
 	defer os.Remove("./bin/create-goose") // clean up
 
+	goBuild(t, "cmd/goose", ".", "../../bin/create-goose")
 	commands := []string{
-		"go build -o ./bin/create-goose ./cmd/goose",
 		fmt.Sprintf("./bin/create-goose -s -dir=%s create create_table", dir),
 		fmt.Sprintf("./bin/create-goose -s -dir=%s create add_users", dir),
 		fmt.Sprintf("./bin/create-goose -s -dir=%s create add_indices", dir),
@@ -53,3 +59,75 @@ func TestSequential(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateWithTemplateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	tmplDir, err := ioutil.TempDir("", "tmpltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmplDir) // clean up
+
+	tmpl := "-- {{.SnakeName}} {{.Package}} {{.Service}} {{.CreatedAt.Year}}\n"
+	if err := ioutil.WriteFile(filepath.Join(tmplDir, "sql.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	SetTemplateDir(tmplDir)
+	defer SetTemplateDir("")
+
+	if err := Create(nil, "billing", dir, "Add Orders", "sql"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(nil, "billing", dir, "fetch user data", "go"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+
+	pkg := packageName(dir)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch filepath.Ext(file) {
+		case ".sql":
+			want := fmt.Sprintf("-- add_orders %s billing %d\n", pkg, time.Now().Year())
+			if string(b) != want {
+				t.Errorf("unexpected sql template output, got %q, want %q", b, want)
+			}
+		case ".go":
+			if !strings.HasPrefix(string(b), "package "+pkg+"\n") {
+				t.Errorf("unexpected go template output: %s", b)
+			}
+			if err := typeCheck(b); err != nil {
+				t.Errorf("go template output doesn't compile against the current API: %v\n%s", err, b)
+			}
+		}
+	}
+}
+
+// typeCheck type-checks the Go file src as if it were in this directory,
+// importing goose and its dependencies from source.
+func typeCheck(src []byte) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "migration.go", src, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check(f.Name.Name, fset, []*ast.File{f}, nil)
+	return err
+}
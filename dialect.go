@@ -3,51 +3,255 @@ package goose
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
-// SQLDialect abstracts the details of specific SQL dialects
-// for goose's few SQL specific statements
-type SQLDialect interface {
-	createVersionTableSQL() string          // sql string to create the db version table
-	insertVersionSQL(service string) string // sql string to insert the initial version table row
-	deleteVersionSQL(service string) string // sql string to delete version
-	migrationSQL(service string) string     // sql string to retrieve migrations
-	dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error)
+// Dialect abstracts the details of specific SQL dialects for goose's few
+// SQL specific statements. Dialects are made available to SetDialect with
+// RegisterDialect; goosetest.RunDialectTests checks an implementation
+// against a real database.
+type Dialect interface {
+	// CreateVersionTableSQL returns the statement creating the version
+	// table, named QuotedTableName().
+	CreateVersionTableSQL() string
+	// InsertVersionSQL returns the statement recording a version. It takes
+	// the version_id, is_applied, description, ticket and author arguments
+	// as '?' placeholders, which gorm binds.
+	InsertVersionSQL(service string) string
+	// DeleteVersionSQL returns the statement deleting a version. It takes
+	// the version_id argument as a '?' placeholder.
+	DeleteVersionSQL(service string) string
+	// MigrationSQL returns the query for the tstamp, is_applied and
+	// description of the latest row of a version. It takes the version_id
+	// argument, using the placeholder style of the database driver.
+	MigrationSQL(service string) string
+	// DBVersionQuery returns the version_id and is_applied of all rows,
+	// most recent first.
+	DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error)
 }
 
-var dialect SQLDialect = &PostgresDialect{}
+// SQLDialect is the former name of Dialect.
+type SQLDialect = Dialect
 
-// GetDialect gets the SQLDialect
-func GetDialect() SQLDialect {
+var (
+	dialectsMu sync.RWMutex
+	dialects   = make(map[string]Dialect)
+)
+
+func init() {
+	RegisterDialect("postgres", &PostgresDialect{})
+	RegisterDialect("cockroach", &CockroachDialect{})
+	RegisterDialect("mysql", &MySQLDialect{})
+	RegisterDialect("sqlite3", &Sqlite3Dialect{})
+	RegisterDialect("mssql", &SqlServerDialect{})
+	RegisterDialect("redshift", &RedshiftDialect{})
+	RegisterDialect("tidb", &TiDBDialect{})
+	RegisterDialect("clickhouse", &ClickHouseDialect{})
+	RegisterDialect("duckdb", &DuckDBDialect{})
+}
+
+// RegisterDialect makes a dialect available to SetDialect under name.
+// Registering a name twice replaces the previous dialect.
+func RegisterDialect(name string, d Dialect) {
+	if d == nil {
+		panic("goose: RegisterDialect dialect is nil")
+	}
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = d
+}
+
+// Dialects returns the sorted names of the registered dialects.
+func Dialects() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	dialect     Dialect = &PostgresDialect{}
+	dialectName         = "postgres"
+)
+
+// GetDialect gets the Dialect
+func GetDialect() Dialect {
 	return dialect
 }
 
-// SetDialect sets the SQLDialect
+// lookupDialect returns the dialect registered under name.
+func lookupDialect(name string) (Dialect, bool) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// SetDialect sets the Dialect to the one registered under d.
 func SetDialect(d string) error {
-	switch d {
-	case "postgres":
-		dialect = &PostgresDialect{}
-	case "mysql":
-		dialect = &MySQLDialect{}
-	case "sqlite3":
-		dialect = &Sqlite3Dialect{}
-	case "mssql":
-		dialect = &SqlServerDialect{}
-	case "redshift":
-		dialect = &RedshiftDialect{}
-	case "tidb":
-		dialect = &TiDBDialect{}
-	case "clickhouse":
-		dialect = &ClickHouseDialect{}
-	default:
+	registered, ok := lookupDialect(d)
+	if !ok {
 		return fmt.Errorf("%q: unknown dialect", d)
 	}
+	dialect = registered
+	dialectName = d
 
 	return nil
 }
 
+// Locker is implemented by dialects that keep concurrent goose processes
+// from migrating the same service at once. Run holds the lock while running
+// commands that apply or roll back migrations.
+type Locker interface {
+	Lock(db *gorm.DB, service string) error
+	Unlock(db *gorm.DB, service string) error
+}
+
+// SessionPreparer is implemented by dialects that need settings on the
+// connection migrations run on. Run executes commands that apply or roll
+// back migrations on a single connection, after running SessionSQL on it;
+// migrations applied or rolled back otherwise, like with Up, each run on
+// a connection prepared the same way.
+type SessionPreparer interface {
+	SessionSQL() []string
+}
+
+// VersionTxSeparator is implemented by dialects that record versions in a
+// transaction of their own, after the one running the migration statements.
+type VersionTxSeparator interface {
+	SeparateVersionTx() bool
+}
+
+// separateVersionTx reports whether the current dialect records versions
+// in a separate transaction.
+func separateVersionTx() bool {
+	s, ok := GetDialect().(VersionTxSeparator)
+	return ok && s.SeparateVersionTx()
+}
+
+// RetryClassifier is implemented by dialects that tell transient errors,
+// like serialization failures, deadlocks and lock timeouts, from others.
+// Migrations that ran in a transaction and failed with a retryable error
+// are run again as the retry policy allows, see SetRetryPolicy.
+type RetryClassifier interface {
+	IsRetryable(err error) bool
+}
+
+// ServiceScoper is implemented by dialects whose version table records the
+// service of every version, so services sharing a database keep their
+// versions apart. Requirements on other services need it.
+type ServiceScoper interface {
+	ScopesServices() bool
+}
+
+// scopesServices reports whether the current dialect records the service
+// of versions.
+func scopesServices() bool {
+	s, ok := GetDialect().(ServiceScoper)
+	return ok && s.ScopesServices()
+}
+
+// IdentifierQuoter is implemented by dialects that quote identifiers other
+// than in the double quotes of standard SQL. QuotedTableName uses it.
+type IdentifierQuoter interface {
+	QuoteIdentifier(name string) string
+}
+
+// SchemaCreator is implemented by dialects that can create the schema of
+// the version table, see SetCreateSchema. CreateSchemaSQL must not fail if
+// the schema exists. The schemas of MySQL, TiDB and ClickHouse are
+// databases.
+type SchemaCreator interface {
+	CreateSchemaSQL(schema string) string
+}
+
+// ColumnTypeAlterMatcher is implemented by dialects that change column
+// types with other statements than the ALTER COLUMN ... TYPE of Postgres.
+// The alter-column-type lint rule uses it; stmt is normalized to upper case
+// with single spaces and no comments.
+type ColumnTypeAlterMatcher interface {
+	AltersColumnType(stmt string) bool
+}
+
+// SearchPathSetter is implemented by dialects that look up unqualified
+// table names on a schema search path. RunTenants needs it to migrate
+// every schema with its own version table.
+type SearchPathSetter interface {
+	SearchPathSQL(schema string) (set, reset string)
+}
+
+// CompanionTableCreator is implemented by dialects that create the tables
+// goose keeps next to the version table with other statements than the
+// standard SQL ones, for their column types or table engines. Each method
+// gets the quoted name of the table and returns "" to use the standard
+// statement.
+type CompanionTableCreator interface {
+	// CreateDirtyTableSQL creates the dirty state table, with the service,
+	// version_id, applied_statements and last_error columns.
+	CreateDirtyTableSQL(table string) string
+	// CreateMetaTableSQL creates the meta-version table, with the
+	// meta_version column.
+	CreateMetaTableSQL(table string) string
+	// CreateBackgroundTableSQL creates the background jobs table, with the
+	// service, version_id, status, cursor_value, batches, last_error,
+	// locked_by, locked_until and updated_at columns.
+	CreateBackgroundTableSQL(table string) string
+}
+
+// RowDeleter is implemented by dialects that delete rows with other
+// statements than DELETE FROM. DeleteSQL returns the statement deleting the
+// rows of table matching where, which may hold '?' placeholders.
+type RowDeleter interface {
+	DeleteSQL(table, where string) string
+}
+
+// deleteSQL returns the statement of the current dialect deleting the rows
+// of table matching where.
+func deleteSQL(table, where string) string {
+	if d, ok := GetDialect().(RowDeleter); ok {
+		return d.DeleteSQL(table, where)
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", table, where)
+}
+
+// TxSupporter is implemented by dialects whose databases may lack
+// transactions. Without them, version table upgrades run outside of
+// transactions and background migrations, which record their progress in
+// the transaction of each batch, are refused.
+type TxSupporter interface {
+	SupportsTx() bool
+}
+
+// supportsTx reports whether the current dialect has transactions.
+func supportsTx() bool {
+	s, ok := GetDialect().(TxSupporter)
+	return !ok || s.SupportsTx()
+}
+
+// NameFolder is implemented by dialects whose databases fold unquoted
+// identifiers to lower case. Older releases of goose didn't quote the name
+// of the version table, so these dialects look for it under the folded
+// name too.
+type NameFolder interface {
+	FoldsUnquotedNames() bool
+}
+
+// stdTableName returns the version table name quoted in double quotes.
+func stdTableName() string {
+	return quotedTableName(quoteIdentifier, "")
+}
+
 ////////////////////////////
 // Postgres
 ////////////////////////////
@@ -55,23 +259,26 @@ func SetDialect(d string) error {
 // PostgresDialect struct.
 type PostgresDialect struct{}
 
-func (pg PostgresDialect) createVersionTableSQL() string {
+func (pg PostgresDialect) CreateVersionTableSQL() string {
 	return fmt.Sprintf(`CREATE TABLE %s (
             	id serial NOT NULL,
 				version_id bigint NOT NULL,
 				service varchar(100) NOT NULL,
                 is_applied boolean NOT NULL,
                 tstamp timestamp NULL default now(),
+                description text NULL,
+                ticket varchar(100) NULL,
+                author varchar(255) NULL,
                 PRIMARY KEY(id)
-            );`, TableName())
+            );`, stdTableName())
 }
 
-func (pg PostgresDialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, service) VALUES (?, ?, '%s');", TableName(), service)
+func (pg PostgresDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, service, description, ticket, author) VALUES (?, ?, '%s', ?, ?, ?);", stdTableName(), service)
 }
 
-func (pg PostgresDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s where service='%s' ORDER BY id DESC", TableName(), service)).Rows()
+func (pg PostgresDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s where service='%s' ORDER BY id DESC", stdTableName(), service)).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -79,38 +286,286 @@ func (pg PostgresDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows
 	return rows, err
 }
 
-func (m PostgresDialect) migrationSQL(service string) string {
-	return fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id=$1 and service='%s' ORDER BY tstamp DESC LIMIT 1", TableName(), service)
+func (m PostgresDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=$1 and service='%s' ORDER BY tstamp DESC LIMIT 1", stdTableName(), service)
+}
+
+func (pg PostgresDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=? and service='%s';", stdTableName(), service)
+}
+
+func (pg PostgresDialect) FoldsUnquotedNames() bool {
+	return true
+}
+
+func (pg PostgresDialect) ScopesServices() bool {
+	return true
+}
+
+// IsRetryable is true for serialization failures, deadlocks and lock
+// timeouts.
+func (pg PostgresDialect) IsRetryable(err error) bool {
+	return hasSQLState(err, "40001", "40P01", "55P03")
+}
+
+func (pg PostgresDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE SCHEMA IF NOT EXISTS " + quoteIdentifier(schema)
+}
+
+// SearchPathSQL sets search_path to schema only.
+func (pg PostgresDialect) SearchPathSQL(schema string) (set, reset string) {
+	return "SET search_path TO " + quoteIdentifier(schema), "RESET search_path"
+}
+
+// UpgradeLockSQL takes a transaction-level advisory lock.
+func (pg PostgresDialect) UpgradeLockSQL(key string) (lock, unlock string) {
+	return fmt.Sprintf("SELECT pg_advisory_xact_lock(hashtext('%s'))", strings.Replace(key, "'", "''", -1)), ""
 }
 
-func (pg PostgresDialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1 and service='%s';", TableName(), service)
+func (pg PostgresDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", stdTableName(),
+		"description text NULL", "ticket varchar(100) NULL", "author varchar(255) NULL")
+}
+
+////////////////////////////
+// CockroachDB
+////////////////////////////
+
+// CockroachDialect struct. Unlike serial ids on CockroachDB, the seq column
+// of the version table increases by one per row of a service, so it orders
+// the rows reliably. Schema changes run in a transaction of their own, and
+// migrations are serialized with a lock table rather than advisory locks.
+type CockroachDialect struct {
+	LockTimeout time.Duration // how long Lock waits for another process, defaults to 5 minutes
+	LockTTL     time.Duration // how long a lock outlives its last heartbeat, defaults to 1 hour
+}
+
+func (c CockroachDialect) CreateVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                seq INT8 NOT NULL,
+                version_id INT8 NOT NULL,
+                service STRING NOT NULL,
+                is_applied BOOL NOT NULL,
+                tstamp TIMESTAMP NULL DEFAULT now(),
+                description STRING NULL,
+                ticket STRING NULL,
+                author STRING NULL,
+                PRIMARY KEY (service, seq)
+            );`, stdTableName())
+}
+
+// InsertVersionSQL numbers the row after the latest one of the service.
+// Concurrent inserts conflict on the primary key instead of interleaving.
+func (c CockroachDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf(`INSERT INTO %s (seq, version_id, is_applied, service, description, ticket, author)
+            SELECT COALESCE(MAX(seq), 0) + 1, ?::INT8, ?::BOOL, '%s', ?::STRING, ?::STRING, ?::STRING
+            FROM %s WHERE service='%s';`, stdTableName(), service, stdTableName(), service)
+}
+
+func (c CockroachDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s where service='%s' ORDER BY seq DESC", stdTableName(), service)).Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, err
+}
+
+func (c CockroachDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=$1 and service='%s' ORDER BY seq DESC LIMIT 1", stdTableName(), service)
+}
+
+func (c CockroachDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=? and service='%s';", stdTableName(), service)
+}
+
+// SeparateVersionTx is true, since CockroachDB can't reliably mix schema
+// changes with writes in a single transaction.
+func (c CockroachDialect) SeparateVersionTx() bool {
+	return true
+}
+
+func (c CockroachDialect) ScopesServices() bool {
+	return true
+}
+
+func (c CockroachDialect) FoldsUnquotedNames() bool {
+	return true
+}
+
+// IsRetryable is true for the transaction retry errors of CockroachDB.
+func (c CockroachDialect) IsRetryable(err error) bool {
+	return hasSQLState(err, "40001")
+}
+
+func (c CockroachDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE SCHEMA IF NOT EXISTS " + quoteIdentifier(schema)
+}
+
+func (c CockroachDialect) lockTableName() string {
+	return quotedTableName(quoteIdentifier, "_lock")
+}
+
+func (c CockroachDialect) lockTTL() time.Duration {
+	if c.LockTTL == 0 {
+		return time.Hour
+	}
+	return c.LockTTL
+}
+
+// lockPollInterval is how often Lock checks whether a lock was released.
+var lockPollInterval = time.Second
+
+var (
+	cockroachLocksMu sync.Mutex
+	cockroachLocks   = make(map[string]*cockroachLock) // by lock table and service
+)
+
+// cockroachLock is a lock held by this process, kept alive by a heartbeat.
+type cockroachLock struct {
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func (c CockroachDialect) createLockTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+                service STRING NOT NULL PRIMARY KEY,
+                owner STRING NOT NULL,
+                locked_until INT8 NOT NULL
+            );`, c.lockTableName())
+}
+
+// Lock inserts a row for service into the lock table, waiting while another
+// process holds it. The row holds the lock for LockTTL, and a heartbeat
+// extends it until Unlock; rows that expired are taken over.
+func (c CockroachDialect) Lock(db *gorm.DB, service string) error {
+	timeout := c.LockTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+
+	if r := db.Exec(c.createLockTableSQL()); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to create lock table")
+	}
+
+	lock := &cockroachLock{owner: workerName(), stop: make(chan struct{}), done: make(chan struct{})}
+	deadline := time.Now().Add(timeout)
+	for {
+		now := time.Now()
+		if r := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE service = ? AND locked_until < ?", c.lockTableName()), service, now.UnixNano()); r.Error != nil {
+			return errors.Wrap(r.Error, "failed to clear expired lock")
+		}
+
+		r := db.Exec(fmt.Sprintf("INSERT INTO %s (service, owner, locked_until) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", c.lockTableName()),
+			service, lock.owner, now.Add(c.lockTTL()).UnixNano())
+		if r.Error != nil {
+			return errors.Wrap(r.Error, "failed to take lock")
+		}
+		if r.RowsAffected == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return errors.Errorf("service %q is locked by another goose process; waited %v", service, timeout)
+		}
+		verboseInfo("goose: waiting for the lock of service %q", service)
+		time.Sleep(lockPollInterval)
+	}
+
+	cockroachLocksMu.Lock()
+	cockroachLocks[c.lockTableName()+" "+service] = lock
+	cockroachLocksMu.Unlock()
+	go c.heartbeat(db, service, lock)
+	return nil
+}
+
+// heartbeat extends the lock three times per LockTTL until it is stopped.
+func (c CockroachDialect) heartbeat(db *gorm.DB, service string, lock *cockroachLock) {
+	defer close(lock.done)
+	ticker := time.NewTicker(c.lockTTL() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			r := db.Exec(fmt.Sprintf("UPDATE %s SET locked_until = ? WHERE service = ? AND owner = ?", c.lockTableName()),
+				time.Now().Add(c.lockTTL()).UnixNano(), service, lock.owner)
+			switch {
+			case r.Error != nil:
+				logFor(db).Printf("goose: failed to extend the lock of service %q: %v\n", service, r.Error)
+			case r.RowsAffected == 0:
+				logFor(db).Printf("goose: lost the lock of service %q\n", service)
+				return
+			}
+		}
+	}
+}
+
+// Unlock stops the heartbeat and releases the lock of service.
+func (c CockroachDialect) Unlock(db *gorm.DB, service string) error {
+	key := c.lockTableName() + " " + service
+	cockroachLocksMu.Lock()
+	lock, ok := cockroachLocks[key]
+	delete(cockroachLocks, key)
+	cockroachLocksMu.Unlock()
+	if !ok {
+		return errors.Errorf("service %q is not locked by this process", service)
+	}
+	close(lock.stop)
+	<-lock.done
+
+	if r := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE service = ? AND owner = ?", c.lockTableName()), service, lock.owner); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to release lock")
+	}
+	return nil
 }
 
 ////////////////////////////
 // MySQL
 ////////////////////////////
 
-// MySQLDialect struct.
-type MySQLDialect struct{}
+// MySQLDialect struct. goose doesn't import a MySQL driver, so it leaves
+// telling transient errors apart to Retry, which the goose binary sets for
+// go-sql-driver/mysql.
+type MySQLDialect struct {
+	Retry RetryClassifier // classifies the errors of the driver, no retries if nil
+}
+
+// QuoteIdentifier quotes name in backticks.
+func (m MySQLDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (m MySQLDialect) tableName() string {
+	return quotedTableName(m.QuoteIdentifier, "")
+}
+
+func (m MySQLDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE DATABASE IF NOT EXISTS " + m.QuoteIdentifier(schema)
+}
 
-func (m MySQLDialect) createVersionTableSQL() string {
+func (m MySQLDialect) CreateVersionTableSQL() string {
 	return fmt.Sprintf(`CREATE TABLE %s (
                 id serial NOT NULL,
 				version_id bigint NOT NULL,
 				service varchar(100) NOT NULL,
                 is_applied boolean NOT NULL,
                 tstamp timestamp NULL default now(),
+                description text NULL,
+                ticket varchar(100) NULL,
+                author varchar(255) NULL,
                 PRIMARY KEY(id)
-            );`, TableName())
+            );`, m.tableName())
 }
 
-func (m MySQLDialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (m MySQLDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, description, ticket, author) VALUES (?, ?, ?, ?, ?);", m.tableName())
 }
 
-func (m MySQLDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", TableName())).Rows()
+func (m MySQLDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", m.tableName())).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -118,36 +573,80 @@ func (m MySQLDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, er
 	return rows, err
 }
 
-func (m MySQLDialect) migrationSQL(service string) string {
-	return fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id=? ORDER BY tstamp DESC LIMIT 1", TableName())
+func (m MySQLDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=? ORDER BY tstamp DESC LIMIT 1", m.tableName())
+}
+
+func (m MySQLDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", m.tableName())
+}
+
+// IsRetryable asks Retry, if set.
+func (m MySQLDialect) IsRetryable(err error) bool {
+	return m.Retry != nil && m.Retry.IsRetryable(err)
+}
+
+// AltersColumnType matches MODIFY and CHANGE clauses.
+func (m MySQLDialect) AltersColumnType(stmt string) bool {
+	return matchAlterTypeMy.MatchString(stmt)
 }
 
-func (m MySQLDialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+// UpgradeLockSQL takes a named lock of the session, which DDL committing
+// the transaction doesn't release. Names are hashed to fit in 64 characters.
+func (m MySQLDialect) UpgradeLockSQL(key string) (lock, unlock string) {
+	key = strings.Replace(key, "'", "''", -1)
+	return fmt.Sprintf("SELECT GET_LOCK(SHA1('%s'), -1)", key), fmt.Sprintf("SELECT RELEASE_LOCK(SHA1('%s'))", key)
+}
+
+func (m MySQLDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", m.tableName(),
+		"description text NULL", "ticket varchar(100) NULL", "author varchar(255) NULL")
 }
 
 ////////////////////////////
 // MSSQL
 ////////////////////////////
 
-// SqlServerDialect struct.
+// SqlServerDialect struct. The schema of the version table defaults to the
+// one of the login, usually dbo.
 type SqlServerDialect struct{}
 
-func (m SqlServerDialect) createVersionTableSQL() string {
+// QuoteIdentifier quotes name in brackets.
+func (m SqlServerDialect) QuoteIdentifier(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+func (m SqlServerDialect) tableName() string {
+	return quotedTableName(m.QuoteIdentifier, "")
+}
+
+// CreateSchemaSQL runs CREATE SCHEMA through EXEC, as it must be alone in
+// its batch.
+func (m SqlServerDialect) CreateSchemaSQL(schema string) string {
+	create := "CREATE SCHEMA " + m.QuoteIdentifier(schema)
+	return fmt.Sprintf("IF SCHEMA_ID(N'%s') IS NULL EXEC(N'%s')",
+		strings.Replace(schema, "'", "''", -1), strings.Replace(create, "'", "''", -1))
+}
+
+func (m SqlServerDialect) CreateVersionTableSQL() string {
 	return fmt.Sprintf(`CREATE TABLE %s (
                 id INT NOT NULL IDENTITY(1,1) PRIMARY KEY,
                 version_id BIGINT NOT NULL,
+                service NVARCHAR(100) NOT NULL,
                 is_applied BIT NOT NULL,
-                tstamp DATETIME NULL DEFAULT CURRENT_TIMESTAMP
-            );`, TableName())
+                tstamp DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+                description NVARCHAR(MAX) NULL,
+                ticket NVARCHAR(100) NULL,
+                author NVARCHAR(255) NULL
+            );`, m.tableName())
 }
 
-func (m SqlServerDialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (m SqlServerDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, service, description, ticket, author) VALUES (?, ?, N'%s', ?, ?, ?);", m.tableName(), service)
 }
 
-func (m SqlServerDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied FROM %s ORDER BY id DESC", TableName())).Rows()
+func (m SqlServerDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied FROM %s WHERE service=N'%s' ORDER BY id DESC", m.tableName(), service)).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -155,25 +654,73 @@ func (m SqlServerDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows
 	return rows, err
 }
 
-func (m SqlServerDialect) migrationSQL(service string) string {
-	const tpl = `
-WITH Migrations AS
-(
-    SELECT tstamp, is_applied,
-    ROW_NUMBER() OVER (ORDER BY tstamp) AS 'RowNumber'
-    FROM %s
-	WHERE version_id=@p1
-)
-SELECT tstamp, is_applied
-FROM Migrations
-WHERE RowNumber BETWEEN 1 AND 2
-ORDER BY tstamp DESC
-`
-	return fmt.Sprintf(tpl, TableName())
+func (m SqlServerDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT TOP 1 tstamp, is_applied, description FROM %s WHERE version_id=@p1 AND service=N'%s' ORDER BY id DESC", m.tableName(), service)
+}
+
+func (m SqlServerDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=? AND service=N'%s';", m.tableName(), service)
+}
+
+func (m SqlServerDialect) ScopesServices() bool {
+	return true
+}
+
+// IsRetryable is true for deadlock victims and lock request timeouts.
+func (m SqlServerDialect) IsRetryable(err error) bool {
+	return hasSQLErrorNumber(err, 1205, 1222)
 }
 
-func (m SqlServerDialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=@p1;", TableName())
+// AltersColumnType matches ALTER COLUMN clauses other than the ADD and DROP
+// of constraints.
+func (m SqlServerDialect) AltersColumnType(stmt string) bool {
+	match := matchAlterTypeMs.FindStringSubmatch(stmt)
+	return match != nil && match[1] != "ADD" && match[1] != "DROP"
+}
+
+// CreateDirtyTableSQL uses NVARCHAR columns.
+func (m SqlServerDialect) CreateDirtyTableSQL(table string) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                service NVARCHAR(100) NOT NULL PRIMARY KEY,
+                version_id BIGINT NOT NULL,
+                applied_statements INT NOT NULL,
+                last_error NVARCHAR(MAX) NULL
+            );`, table)
+}
+
+func (m SqlServerDialect) CreateMetaTableSQL(table string) string {
+	return ""
+}
+
+// CreateBackgroundTableSQL uses NVARCHAR columns.
+func (m SqlServerDialect) CreateBackgroundTableSQL(table string) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                service NVARCHAR(100) NOT NULL,
+                version_id BIGINT NOT NULL,
+                status NVARCHAR(20) NOT NULL,
+                cursor_value NVARCHAR(MAX) NULL,
+                batches BIGINT NOT NULL,
+                last_error NVARCHAR(MAX) NULL,
+                locked_by NVARCHAR(255) NULL,
+                locked_until BIGINT NOT NULL,
+                updated_at BIGINT NOT NULL,
+                PRIMARY KEY (service, version_id)
+            );`, table)
+}
+
+// UpgradeLockSQL takes an application lock owned by the transaction.
+func (m SqlServerDialect) UpgradeLockSQL(key string) (lock, unlock string) {
+	return fmt.Sprintf(`DECLARE @result INT;
+EXEC @result = sp_getapplock @Resource = N'%s', @LockMode = 'Exclusive', @LockOwner = 'Transaction';
+IF @result < 0 RAISERROR('failed to lock the version table upgrade', 16, 1);`, strings.Replace(key, "'", "''", -1)), ""
+}
+
+// VersionTableUpgrades adds the service column last, filled with service on
+// the rows recorded before it.
+func (m SqlServerDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD %s", m.tableName(),
+		"description NVARCHAR(MAX) NULL", "ticket NVARCHAR(100) NULL", "author NVARCHAR(255) NULL",
+		fmt.Sprintf("service NVARCHAR(100) NOT NULL DEFAULT N'%s'", strings.Replace(service, "'", "''", -1)))
 }
 
 ////////////////////////////
@@ -183,21 +730,24 @@ func (m SqlServerDialect) deleteVersionSQL(service string) string {
 // Sqlite3Dialect struct.
 type Sqlite3Dialect struct{}
 
-func (m Sqlite3Dialect) createVersionTableSQL() string {
+func (m Sqlite3Dialect) CreateVersionTableSQL() string {
 	return fmt.Sprintf(`CREATE TABLE %s (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 version_id INTEGER NOT NULL,
                 is_applied INTEGER NOT NULL,
-                tstamp TIMESTAMP DEFAULT (datetime('now'))
-            );`, TableName())
+                tstamp TIMESTAMP DEFAULT (datetime('now')),
+                description TEXT NULL,
+                ticket TEXT NULL,
+                author TEXT NULL
+            );`, stdTableName())
 }
 
-func (m Sqlite3Dialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (m Sqlite3Dialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, description, ticket, author) VALUES (?, ?, ?, ?, ?);", stdTableName())
 }
 
-func (m Sqlite3Dialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", TableName())).Rows()
+func (m Sqlite3Dialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", stdTableName())).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -205,12 +755,22 @@ func (m Sqlite3Dialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows,
 	return rows, err
 }
 
-func (m Sqlite3Dialect) migrationSQL(service string) string {
-	return fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id=? ORDER BY tstamp DESC LIMIT 1", TableName())
+func (m Sqlite3Dialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=? ORDER BY tstamp DESC LIMIT 1", stdTableName())
+}
+
+func (m Sqlite3Dialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", stdTableName())
 }
 
-func (m Sqlite3Dialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+// IsRetryable is true when the database or a table is locked.
+func (m Sqlite3Dialect) IsRetryable(err error) bool {
+	return isSqliteBusy(err)
+}
+
+func (m Sqlite3Dialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", stdTableName(),
+		"description TEXT NULL", "ticket TEXT NULL", "author TEXT NULL")
 }
 
 ////////////////////////////
@@ -220,22 +780,25 @@ func (m Sqlite3Dialect) deleteVersionSQL(service string) string {
 // RedshiftDialect struct.
 type RedshiftDialect struct{}
 
-func (rs RedshiftDialect) createVersionTableSQL() string {
+func (rs RedshiftDialect) CreateVersionTableSQL() string {
 	return fmt.Sprintf(`CREATE TABLE %s (
             	id integer NOT NULL identity(1, 1),
                 version_id bigint NOT NULL,
                 is_applied boolean NOT NULL,
                 tstamp timestamp NULL default sysdate,
+                description varchar(1024) NULL,
+                ticket varchar(100) NULL,
+                author varchar(255) NULL,
                 PRIMARY KEY(id)
-            );`, TableName())
+            );`, stdTableName())
 }
 
-func (rs RedshiftDialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (rs RedshiftDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, description, ticket, author) VALUES (?, ?, ?, ?, ?);", stdTableName())
 }
 
-func (rs RedshiftDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", TableName())).Rows()
+func (rs RedshiftDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", stdTableName())).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -243,37 +806,74 @@ func (rs RedshiftDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows
 	return rows, err
 }
 
-func (m RedshiftDialect) migrationSQL(service string) string {
-	return fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id=$1 ORDER BY tstamp DESC LIMIT 1", TableName())
+func (m RedshiftDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=$1 ORDER BY tstamp DESC LIMIT 1", stdTableName())
+}
+
+func (rs RedshiftDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", stdTableName())
+}
+
+func (rs RedshiftDialect) FoldsUnquotedNames() bool {
+	return true
+}
+
+// IsRetryable is true for serialization failures and deadlocks.
+func (rs RedshiftDialect) IsRetryable(err error) bool {
+	return hasSQLState(err, "40001", "40P01")
 }
 
-func (rs RedshiftDialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1;", TableName())
+func (rs RedshiftDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE SCHEMA IF NOT EXISTS " + quoteIdentifier(schema)
+}
+
+func (rs RedshiftDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", stdTableName(),
+		"description varchar(1024) NULL", "ticket varchar(100) NULL", "author varchar(255) NULL")
 }
 
 ////////////////////////////
 // TiDB
 ////////////////////////////
 
-// TiDBDialect struct.
-type TiDBDialect struct{}
+// TiDBDialect struct. Like MySQLDialect, it leaves telling transient errors
+// apart to Retry.
+type TiDBDialect struct {
+	Retry RetryClassifier // classifies the errors of the driver, no retries if nil
+}
+
+// QuoteIdentifier quotes name in backticks.
+func (m TiDBDialect) QuoteIdentifier(name string) string {
+	return MySQLDialect{}.QuoteIdentifier(name)
+}
 
-func (m TiDBDialect) createVersionTableSQL() string {
+func (m TiDBDialect) tableName() string {
+	return quotedTableName(m.QuoteIdentifier, "")
+}
+
+func (m TiDBDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE DATABASE IF NOT EXISTS " + m.QuoteIdentifier(schema)
+}
+
+func (m TiDBDialect) CreateVersionTableSQL() string {
 	return fmt.Sprintf(`CREATE TABLE %s (
                 id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE,
                 version_id bigint NOT NULL,
                 is_applied boolean NOT NULL,
                 tstamp timestamp NULL default now(),
+                description text NULL,
+                ticket varchar(100) NULL,
+                author varchar(255) NULL,
                 PRIMARY KEY(id)
-            );`, TableName())
+            );`, m.tableName())
 }
 
-func (m TiDBDialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (m TiDBDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, description, ticket, author) VALUES (?, ?, ?, ?, ?);", m.tableName())
 }
 
-func (m TiDBDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", TableName())).Rows()
+func (m TiDBDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s ORDER BY id DESC", m.tableName())).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -281,48 +881,209 @@ func (m TiDBDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, err
 	return rows, err
 }
 
-func (m TiDBDialect) migrationSQL(service string) string {
-	return fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id=? ORDER BY tstamp DESC LIMIT 1", TableName())
+func (m TiDBDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=? ORDER BY tstamp DESC LIMIT 1", m.tableName())
+}
+
+func (m TiDBDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", m.tableName())
+}
+
+// IsRetryable asks Retry, if set.
+func (m TiDBDialect) IsRetryable(err error) bool {
+	return m.Retry != nil && m.Retry.IsRetryable(err)
+}
+
+// AltersColumnType matches MODIFY and CHANGE clauses.
+func (m TiDBDialect) AltersColumnType(stmt string) bool {
+	return matchAlterTypeMy.MatchString(stmt)
 }
 
-func (m TiDBDialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+func (m TiDBDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", m.tableName(),
+		"description text NULL", "ticket varchar(100) NULL", "author varchar(255) NULL")
 }
 
 ////////////////////////////
 // ClickHouse
 ////////////////////////////
 
-// ClickHouseDialect struct.
-type ClickHouseDialect struct{}
+// ClickHouseDialect struct. The version table is a ReplacingMergeTree, or a
+// ReplicatedReplacingMergeTree created ON CLUSTER when Cluster is set, that
+// keeps the latest row of every version of a service. Migrations run on a
+// connection with mutations_sync=2, so ALTER TABLE mutations, like the one
+// of DeleteVersionSQL, have finished on all replicas before the next
+// statement runs.
+type ClickHouseDialect struct {
+	Cluster string // cluster the version table is created and altered on
+}
+
+func (m ClickHouseDialect) onCluster() string {
+	if m.Cluster == "" {
+		return ""
+	}
+	return " ON CLUSTER " + m.QuoteIdentifier(m.Cluster)
+}
+
+// QuoteIdentifier quotes name in backticks, escaping with backslashes.
+func (m ClickHouseDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
+
+func (m ClickHouseDialect) tableName() string {
+	return quotedTableName(m.QuoteIdentifier, "")
+}
 
-func (m ClickHouseDialect) createVersionTableSQL() string {
-	return `
-    CREATE TABLE goose_db_version (
+// CreateSchemaSQL creates the database on the cluster if Cluster is set.
+func (m ClickHouseDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE DATABASE IF NOT EXISTS " + m.QuoteIdentifier(schema) + m.onCluster()
+}
+
+func (m ClickHouseDialect) CreateVersionTableSQL() string {
+	engine := "ReplacingMergeTree(tstamp)"
+	if m.Cluster != "" {
+		engine = "ReplicatedReplacingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}', tstamp)"
+	}
+	return fmt.Sprintf(`
+    CREATE TABLE %s%s (
       version_id Int64,
+      service String,
       is_applied UInt8,
-      date Date default now(),
-      tstamp DateTime default now()
-    ) Engine = MergeTree(date, (date), 8192)
-	`
+      tstamp DateTime64(9) DEFAULT now64(9),
+      description String,
+      ticket String,
+      author String
+    ) ENGINE = %s
+    ORDER BY (service, version_id)
+	`, m.tableName(), m.onCluster(), engine)
+}
+
+func (m ClickHouseDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied FROM %s WHERE service = '%s' ORDER BY tstamp DESC", m.tableName(), service)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	return rows, err
+}
+
+func (m ClickHouseDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, service, description, ticket, author) VALUES (?, ?, '%s', ?, ?, ?)", m.tableName(), service)
+}
+
+func (m ClickHouseDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id = ? AND service = '%s' ORDER BY tstamp DESC LIMIT 1", m.tableName(), service)
+}
+
+func (m ClickHouseDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("ALTER TABLE %s%s DELETE WHERE version_id = ? AND service = '%s'", m.tableName(), m.onCluster(), service)
+}
+
+// VersionTableUpgrades adds the service and metadata columns to tables of
+// the former ClickHouse dialect. Their rows are taken to be of service.
+func (m ClickHouseDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", m.tableName()+m.onCluster(),
+		fmt.Sprintf("service String DEFAULT '%s'", strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(service)),
+		"description String", "ticket String", "author String")
+}
+
+func (m ClickHouseDialect) ScopesServices() bool {
+	return true
+}
+
+// mergeTree returns the engine of the companion tables, replicated if
+// Cluster is set.
+func (m ClickHouseDialect) mergeTree() string {
+	if m.Cluster == "" {
+		return "MergeTree()"
+	}
+	return "ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')"
+}
+
+// CreateDirtyTableSQL creates the table on the cluster if Cluster is set.
+func (m ClickHouseDialect) CreateDirtyTableSQL(table string) string {
+	return fmt.Sprintf(`CREATE TABLE %s%s (
+                service String,
+                version_id Int64,
+                applied_statements Int64,
+                last_error String
+            ) ENGINE = %s ORDER BY service`, table, m.onCluster(), m.mergeTree())
+}
+
+// CreateMetaTableSQL creates the table on the cluster if Cluster is set.
+func (m ClickHouseDialect) CreateMetaTableSQL(table string) string {
+	return fmt.Sprintf("CREATE TABLE %s%s (meta_version Int64) ENGINE = %s ORDER BY meta_version", table, m.onCluster(), m.mergeTree())
+}
+
+// CreateBackgroundTableSQL isn't used, as background migrations need
+// transactions.
+func (m ClickHouseDialect) CreateBackgroundTableSQL(table string) string {
+	return ""
+}
+
+// DeleteSQL deletes with a mutation, on the cluster if Cluster is set.
+func (m ClickHouseDialect) DeleteSQL(table, where string) string {
+	return fmt.Sprintf("ALTER TABLE %s%s DELETE WHERE %s", table, m.onCluster(), where)
+}
+
+// SupportsTx is false: ClickHouse has no transactions.
+func (m ClickHouseDialect) SupportsTx() bool {
+	return false
 }
 
-func (m ClickHouseDialect) dbVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
-	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied FROM %s ORDER BY tstamp DESC LIMIT 1", TableName())).Rows()
+// SessionSQL makes mutations synchronous on all replicas.
+func (m ClickHouseDialect) SessionSQL() []string {
+	return []string{"SET mutations_sync = 2"}
+}
+
+////////////////////////////
+// DuckDB
+////////////////////////////
+
+// DuckDBDialect struct. DuckDB has no serial type, so ids come from a
+// sequence created along with the version table.
+type DuckDBDialect struct{}
+
+func (m DuckDBDialect) CreateVersionTableSQL() string {
+	seq := quotedTableName(quoteIdentifier, "_id_seq")
+	return fmt.Sprintf(`CREATE SEQUENCE %[2]s;
+            CREATE TABLE %[1]s (
+                id BIGINT NOT NULL DEFAULT nextval('%[3]s'),
+                version_id BIGINT NOT NULL,
+                service VARCHAR NOT NULL,
+                is_applied BOOLEAN NOT NULL,
+                tstamp TIMESTAMP NULL DEFAULT current_timestamp,
+                description VARCHAR NULL,
+                ticket VARCHAR NULL,
+                author VARCHAR NULL,
+                PRIMARY KEY(id)
+            );`, stdTableName(), seq, strings.Replace(seq, "'", "''", -1))
+}
+
+func (m DuckDBDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, service, description, ticket, author) VALUES (?, ?, '%s', ?, ?, ?);", stdTableName(), service)
+}
+
+func (m DuckDBDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	rows, err := db.Raw(fmt.Sprintf("SELECT version_id, is_applied from %s where service='%s' ORDER BY id DESC", stdTableName(), service)).Rows()
 	if err != nil {
 		return nil, err
 	}
+
 	return rows, err
 }
 
-func (m ClickHouseDialect) insertVersionSQL(service string) string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?)", TableName())
+func (m DuckDBDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id=? and service='%s' ORDER BY id DESC LIMIT 1", stdTableName(), service)
+}
+
+func (m DuckDBDialect) ScopesServices() bool {
+	return true
 }
 
-func (m ClickHouseDialect) migrationSQL(service string) string {
-	return fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id = ? ORDER BY tstamp DESC LIMIT 1", TableName())
+func (m DuckDBDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=? and service='%s';", stdTableName(), service)
 }
 
-func (m ClickHouseDialect) deleteVersionSQL(service string) string {
-	return fmt.Sprintf("ALTER TABLE %s DELETE WHERE version_id = ?", TableName())
+func (m DuckDBDialect) CreateSchemaSQL(schema string) string {
+	return "CREATE SCHEMA IF NOT EXISTS " + quoteIdentifier(schema)
 }
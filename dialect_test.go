@@ -0,0 +1,300 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCockroachDialect(t *testing.T) {
+	t.Parallel()
+
+	var d Dialect = &CockroachDialect{}
+	if _, ok := d.(Locker); !ok {
+		t.Error("CockroachDialect does not implement Locker")
+	}
+	if s, ok := d.(VersionTxSeparator); !ok || !s.SeparateVersionTx() {
+		t.Error("CockroachDialect does not record versions in a separate transaction")
+	}
+}
+
+func TestCockroachDialectSQL(t *testing.T) {
+	t.Parallel()
+
+	c := CockroachDialect{}
+	if sql := c.InsertVersionSQL("billing"); !strings.Contains(sql, `SELECT COALESCE(MAX(seq), 0) + 1, ?::INT8, ?::BOOL, 'billing'`) ||
+		!strings.Contains(sql, `FROM "goose_db_version" WHERE service='billing'`) {
+		t.Errorf("unexpected insert SQL %s", sql)
+	}
+	if sql := c.MigrationSQL("billing"); !strings.HasSuffix(sql, "ORDER BY seq DESC LIMIT 1") {
+		t.Errorf("unexpected migration SQL %s", sql)
+	}
+	if sql := c.createLockTableSQL(); !strings.Contains(sql, `CREATE TABLE IF NOT EXISTS "goose_db_version_lock"`) {
+		t.Errorf("unexpected lock table SQL %s", sql)
+	}
+}
+
+func TestCockroachLock(t *testing.T) {
+	// Changes the lock poll interval, so not parallel.
+	defer func(d time.Duration) { lockPollInterval = d }(lockPollInterval)
+	lockPollInterval = 10 * time.Millisecond
+
+	// The lock table is plain SQL, so SQLite stands in for CockroachDB.
+	db := openMemoryDB(t)
+	first := CockroachDialect{LockTimeout: 50 * time.Millisecond, LockTTL: 100 * time.Millisecond}
+	second := first
+	if err := first.Lock(db, "billing"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The heartbeat keeps the lock past its TTL.
+	time.Sleep(250 * time.Millisecond)
+	if err := second.Lock(db, "billing"); err == nil || !strings.Contains(err.Error(), "locked by another goose process") {
+		t.Fatalf("expected the lock to be held, got %v", err)
+	}
+	if err := second.Lock(db, "accounts"); err != nil {
+		t.Fatalf("expected other services not to be locked, got %v", err)
+	}
+	if err := second.Unlock(db, "accounts"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Unlock(db, "billing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Lock(db, "billing"); err != nil {
+		t.Fatalf("expected the released lock to be taken, got %v", err)
+	}
+	if err := second.Unlock(db, "billing"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Locks whose holder stopped renewing them expire.
+	q := `INSERT INTO "goose_db_version_lock" (service, owner, locked_until) VALUES ('billing', 'gone', ?)`
+	if r := db.Exec(q, time.Now().Add(-time.Second).UnixNano()); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if err := first.Lock(db, "billing"); err != nil {
+		t.Fatalf("expected the expired lock to be taken over, got %v", err)
+	}
+	if err := first.Unlock(db, "billing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClickHouseDialect(t *testing.T) {
+	t.Parallel()
+
+	single := ClickHouseDialect{}
+	if sql := single.CreateVersionTableSQL(); !strings.Contains(sql, "CREATE TABLE `goose_db_version` (") || !strings.Contains(sql, "ENGINE = ReplacingMergeTree(tstamp)") {
+		t.Errorf("unexpected create table SQL:\n%s", sql)
+	}
+
+	cluster := ClickHouseDialect{Cluster: "prod"}
+	if sql := cluster.CreateVersionTableSQL(); !strings.Contains(sql, "`goose_db_version` ON CLUSTER `prod` (") || !strings.Contains(sql, "ReplicatedReplacingMergeTree(") {
+		t.Errorf("unexpected create table SQL:\n%s", sql)
+	}
+	if sql := cluster.CreateVersionTableSQL(); !strings.Contains(sql, "ORDER BY (service, version_id)\n") {
+		t.Errorf("expected versions to be replaced regardless of their timestamp:\n%s", sql)
+	}
+	if sql := cluster.DeleteVersionSQL("billing"); sql != "ALTER TABLE `goose_db_version` ON CLUSTER `prod` DELETE WHERE version_id = ? AND service = 'billing'" {
+		t.Errorf("unexpected delete SQL: %s", sql)
+	}
+}
+
+func TestClickHouseCompanionTables(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	RegisterDialect("clickhouse-value", ClickHouseDialect{Cluster: "prod"})
+	if err := SetDialect("clickhouse-value"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// The tables follow the dialect value, whatever its name.
+	for _, sql := range []string{createDirtyTableSQL(), createMetaTableSQL()} {
+		if !strings.Contains(sql, " ON CLUSTER `prod` (") || !strings.Contains(sql, "ENGINE = ReplicatedMergeTree(") {
+			t.Errorf("unexpected create table SQL:\n%s", sql)
+		}
+	}
+	if sql := deleteSQL(dirtyTableName(), "service = ?"); sql != "ALTER TABLE `goose_db_version_dirty` ON CLUSTER `prod` DELETE WHERE service = ?" {
+		t.Errorf("unexpected delete SQL: %s", sql)
+	}
+	if err := backgroundSupported(); err == nil {
+		t.Error("expected background migrations to be refused")
+	}
+}
+
+func TestSplitQualifiedName(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name string
+		want []string
+	}{
+		{"goose_db_version", []string{"goose_db_version"}},
+		{"ops.goose_db_version", []string{"ops", "goose_db_version"}},
+		{"[ops].[goose_db_version]", []string{"ops", "goose_db_version"}},
+		{"[my.ops].[goose]]db]", []string{"my.ops", "goose]db"}},
+	}
+	for _, test := range tt {
+		if got := splitQualifiedName(test.name, '[', ']'); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitQualifiedName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuotedTableName(t *testing.T) {
+	// Changes the version table, so not parallel.
+	defer SetVersionTable("", "goose_db_version")
+
+	SetTableName(`"Ops"."Order"`)
+	if schema, table := VersionTable(); schema != "Ops" || table != "Order" {
+		t.Fatalf("SetTableName parsed %q and %q", schema, table)
+	}
+	if name := TableName(); name != "Ops.Order" {
+		t.Errorf("unexpected table name %q", name)
+	}
+
+	SetVersionTable("my ops", "goose`db\"version")
+	tt := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{PostgresDialect{}, "DELETE FROM \"my ops\".\"goose`db\"\"version\" WHERE"},
+		{MySQLDialect{}, "DELETE FROM `my ops`.`goose``db\"version` WHERE"},
+		{SqlServerDialect{}, "DELETE FROM [my ops].[goose`db\"version] WHERE"},
+		{ClickHouseDialect{}, "ALTER TABLE `my ops`.`goose\\`db\"version` DELETE WHERE"},
+	}
+	for _, test := range tt {
+		if sql := test.dialect.DeleteVersionSQL("billing"); !strings.HasPrefix(sql, test.want) {
+			t.Errorf("%T: unexpected delete SQL %s", test.dialect, sql)
+		}
+	}
+
+	want := "IF SCHEMA_ID(N'o''ps') IS NULL EXEC(N'CREATE SCHEMA [o''ps]')"
+	if sql := (SqlServerDialect{}).CreateSchemaSQL("o'ps"); sql != want {
+		t.Errorf("unexpected create schema SQL %s", sql)
+	}
+}
+
+func TestSchemaQualifiedVersionTable(t *testing.T) {
+	// Changes the dialect and the version table, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetVersionTable("main", "Order")
+	defer SetVersionTable("", "goose_db_version")
+
+	db := openMemoryDB(t)
+	if _, err := EnsureDBVersion(db, "test"); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if r := db.Raw(`SELECT COUNT(*) FROM main."Order" WHERE version_id = 0`).Scan(&count); r.Error != nil || count != 1 {
+		t.Fatalf("expected version 0 in the quoted table, got %d rows, %v", count, r.Error)
+	}
+
+	// SQLite can't create schemas.
+	SetCreateSchema(true)
+	defer SetCreateSchema(false)
+	if _, err := EnsureDBVersion(openMemoryDB(t), "test"); err == nil || !strings.Contains(err.Error(), "can't create schemas") {
+		t.Errorf("expected creating the schema to fail, got %v", err)
+	}
+}
+
+func TestFoldedVersionTable(t *testing.T) {
+	// Changes the dialect and the version table, so not parallel.
+	if err := SetDialect("postgres"); err != nil {
+		t.Fatal(err)
+	}
+	SetVersionTable("", "GooseVersions")
+	defer SetVersionTable("", "goose_db_version")
+
+	// SQLite stands in for Postgres, which older releases created the
+	// unquoted table in under its lower-cased name.
+	db := openMemoryDB(t)
+	if err := checkFoldedTableName(db); err != nil {
+		t.Fatalf("expected no error without a lower-cased table, got %v", err)
+	}
+	if r := db.Exec("CREATE TABLE gooseversions (id INTEGER)"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	err := checkFoldedTableName(db)
+	if err == nil || !strings.Contains(err.Error(), `ALTER TABLE "gooseversions" RENAME TO "GooseVersions"`) {
+		t.Fatalf("expected the lower-cased table to stop goose, got %v", err)
+	}
+
+	SetVersionTable("", "gooseversions")
+	if err := checkFoldedTableName(db); err != nil {
+		t.Errorf("expected the lower-cased name to be accepted, got %v", err)
+	}
+}
+
+func TestWithSession(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	// foreign_keys is a per-connection setting.
+	err = withSession(db, []string{"PRAGMA foreign_keys = ON"}, func(db *gorm.DB) error {
+		var enabled int
+		if err := db.Raw("PRAGMA foreign_keys").Row().Scan(&enabled); err != nil {
+			return err
+		}
+		if enabled != 1 {
+			t.Error("session statements did not run on the bound connection")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionOutsideRun(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	RegisterDialect("sqlite3-session", &sessionSqliteDialect{})
+	if err := SetDialect("sqlite3-session"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	enabled := -1
+	up := func(tx *gorm.DB) error {
+		return tx.Raw("PRAGMA foreign_keys").Row().Scan(&enabled)
+	}
+	service := "session"
+	if err := AddNamedMigration(service, "00001_check_session.go", up, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(registeredGoMigrationsByService, service)
+
+	// Up is called directly rather than through Run.
+	if err := Up(openMemoryDB(t), service, dir); err != nil {
+		t.Fatal(err)
+	}
+	if enabled != 1 {
+		t.Errorf("expected the migration to run on a prepared session, foreign_keys is %d", enabled)
+	}
+}
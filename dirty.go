@@ -0,0 +1,156 @@
+package goose
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// DirtyState describes a NO TRANSACTION migration that failed part way
+// through, leaving the database half-migrated.
+type DirtyState struct {
+	Version int64
+	Applied int    // number of statements that succeeded
+	Error   string // error of the statement that failed, if known
+}
+
+func (s DirtyState) String() string {
+	if s.Error == "" {
+		return fmt.Sprintf("version %d is dirty after statement %d", s.Version, s.Applied)
+	}
+	return fmt.Sprintf("version %d is dirty after statement %d: %s", s.Version, s.Applied, s.Error)
+}
+
+var (
+	resumeDirty = false
+	clearDirty  = false
+)
+
+// SetResumeDirty makes up continue a dirty migration after its last
+// successful statement.
+func SetResumeDirty(resume bool) {
+	resumeDirty = resume
+}
+
+// SetClearDirty makes up forget the dirty state and run the migration again
+// from its first statement, once its partial changes were undone by hand.
+// It takes precedence over SetResumeDirty.
+func SetClearDirty(clear bool) {
+	clearDirty = clear
+}
+
+// dirtyTableName returns the name of the table the dirty state is kept in.
+func dirtyTableName() string {
+	return companionTableName("_dirty")
+}
+
+func createDirtyTableSQL() string {
+	if c, ok := GetDialect().(CompanionTableCreator); ok {
+		if q := c.CreateDirtyTableSQL(dirtyTableName()); q != "" {
+			return q
+		}
+	}
+	return fmt.Sprintf(`CREATE TABLE %s (
+                service VARCHAR(100) NOT NULL PRIMARY KEY,
+                version_id BIGINT NOT NULL,
+                applied_statements INTEGER NOT NULL,
+                last_error TEXT NULL
+            );`, dirtyTableName())
+}
+
+// GetDirtyState returns the dirty state of service, or nil if its last NO
+// TRANSACTION migration didn't fail. The dirty table is left alone: if it
+// doesn't exist yet, no migration is dirty.
+func GetDirtyState(db *gorm.DB, service string) (*DirtyState, error) {
+	q := fmt.Sprintf("SELECT version_id, applied_statements, last_error FROM %s WHERE service = ?", dirtyTableName())
+	rows, err := db.Raw(q, service).Rows()
+	if err != nil {
+		if !hasTable(db, dirtyTableName()) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to query dirty state")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.Wrap(rows.Err(), "failed to query dirty state")
+	}
+	var (
+		state   DirtyState
+		message *string
+	)
+	if err := rows.Scan(&state.Version, &state.Applied, &message); err != nil {
+		return nil, errors.Wrap(err, "failed to scan dirty state")
+	}
+	if message != nil {
+		state.Error = *message
+	}
+	return &state, nil
+}
+
+// ensureDirtyTable creates the dirty table if it doesn't exist yet.
+func ensureDirtyTable(db *gorm.DB) error {
+	if hasTable(db, dirtyTableName()) {
+		return nil
+	}
+	if r := db.Exec(createDirtyTableSQL()); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to create dirty table")
+	}
+	return nil
+}
+
+// ClearDirtyState forgets the dirty state of service.
+func ClearDirtyState(db *gorm.DB, service string) error {
+	if r := db.Exec(deleteSQL(dirtyTableName(), "service = ?"), service); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to clear dirty state")
+	}
+	return nil
+}
+
+// setDirtyState records that the first applied statements of version v
+// succeeded, and the error of the next one if it failed.
+func setDirtyState(db *gorm.DB, service string, v int64, applied int, message string) error {
+	if err := ClearDirtyState(db, service); err != nil {
+		return err
+	}
+	q := fmt.Sprintf("INSERT INTO %s (service, version_id, applied_statements, last_error) VALUES (?, ?, ?, ?)", dirtyTableName())
+	if r := db.Exec(q, service, v, applied, message); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to record dirty state")
+	}
+	return nil
+}
+
+// checkDirty makes sure up may run: it fails if service is dirty, unless
+// the dirty state is cleared or the migration resumed.
+func checkDirty(db *gorm.DB, service string) error {
+	state, err := GetDirtyState(db, service)
+	if err != nil || state == nil {
+		return err
+	}
+
+	switch {
+	case clearDirty:
+		logFor(db).Printf("goose: clearing dirty state, %s\n", state)
+		return ClearDirtyState(db, service)
+	case resumeDirty:
+		logFor(db).Printf("goose: resuming version %d after statement %d\n", state.Version, state.Applied)
+		return nil
+	default:
+		return errors.Errorf("%s; run up with -resume to continue after statement %d, or with -clear-dirty to run version %d from the start once its changes are undone",
+			state, state.Applied, state.Version)
+	}
+}
+
+// resumeAt returns the index of the statement version v resumes at, 0
+// unless up resumes a dirty migration of v.
+func resumeAt(db *gorm.DB, service string, v int64) (int, error) {
+	state, err := GetDirtyState(db, service)
+	if err != nil {
+		return 0, err
+	}
+	if !resumeDirty || state == nil || state.Version != v {
+		return 0, nil
+	}
+	return state.Applied, nil
+}
@@ -0,0 +1,110 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirtyMigration(t *testing.T) {
+	// Changes the dialect and the dirty settings, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	defer SetResumeDirty(false)
+	defer SetClearDirty(false)
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := `-- +goose NO TRANSACTION
+-- +goose Up
+CREATE TABLE orders (id INTEGER PRIMARY KEY);
+INSERT INTO customers (id) VALUES (1);
+INSERT INTO orders (id) VALUES (1);
+
+-- +goose Down
+DROP TABLE orders;
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_add_orders.sql"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openMemoryDB(t)
+
+	if err := Up(db, "test", dir); err == nil {
+		t.Fatal("expected the missing customers table to fail the migration")
+	}
+	state, err := GetDirtyState(db, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.Version != 1 || state.Applied != 1 || !strings.Contains(state.Error, "statement #2") {
+		t.Fatalf("unexpected dirty state %+v", state)
+	}
+
+	err = Up(db, "test", dir)
+	if err == nil || !strings.Contains(err.Error(), "-resume") {
+		t.Fatalf("expected up to refuse a dirty database, got %v", err)
+	}
+
+	// Resuming skips the CREATE TABLE, which would fail a second time.
+	if r := db.Exec("CREATE TABLE customers (id INTEGER PRIMARY KEY)"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	SetResumeDirty(true)
+	if err := Up(db, "test", dir); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := GetDirtyState(db, "test"); err != nil || state != nil {
+		t.Fatalf("expected a clean state, got %+v, %v", state, err)
+	}
+	if version, err := GetDBVersion(db, "test"); err != nil || version != 1 {
+		t.Fatalf("expected version 1, got %d, %v", version, err)
+	}
+
+	// Clearing forgets the dirty state and runs the migration from the start.
+	SetResumeDirty(false)
+	if err := setDirtyState(db, "test", 2, 3, "failed"); err != nil {
+		t.Fatal(err)
+	}
+	SetClearDirty(true)
+	if err := Up(db, "test", dir); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := GetDirtyState(db, "test"); err != nil || state != nil {
+		t.Fatalf("expected a clean state, got %+v, %v", state, err)
+	}
+}
+
+func TestGetDirtyState(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	db := openMemoryDB(t)
+
+	// Reading the dirty state doesn't create the dirty table.
+	if state, err := GetDirtyState(db, "test"); err != nil || state != nil {
+		t.Fatalf("expected no dirty state, got %+v, %v", state, err)
+	}
+	if hasTable(db, dirtyTableName()) {
+		t.Fatal("GetDirtyState created the dirty table")
+	}
+
+	// Other errors than a missing table are returned.
+	if r := db.Exec("CREATE TABLE " + dirtyTableName() + " (service TEXT)"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if _, err := GetDirtyState(db, "test"); err == nil || !strings.Contains(err.Error(), "failed to query dirty state") {
+		t.Fatalf("expected a query error, got %v", err)
+	}
+}
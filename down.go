@@ -41,12 +41,12 @@ func DownTo(db *gorm.DB, service, dir string, version int64) error {
 
 		current, err := migrations.Current(currentVersion)
 		if err != nil {
-			log.Printf("goose: no migrations to run. current version: %d\n", currentVersion)
+			logFor(db).Printf("goose: no migrations to run. current version: %d\n", currentVersion)
 			return nil
 		}
 
 		if current.Version <= version {
-			log.Printf("goose: no migrations to run. current version: %d\n", currentVersion)
+			logFor(db).Printf("goose: no migrations to run. current version: %d\n", currentVersion)
 			return nil
 		}
 
@@ -0,0 +1,90 @@
+package goose
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DialectorFunc returns the gorm Dialector that connects to dsn.
+type DialectorFunc func(dsn string) gorm.Dialector
+
+type driver struct {
+	open    DialectorFunc
+	dialect string
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]driver)
+)
+
+// RegisterDriver makes a database driver available to OpenDBWithDriver
+// under name. open builds the gorm Dialector for a DSN and dialect is the
+// goose dialect used with it, as accepted by SetDialect. Registering a name
+// twice replaces the previous driver.
+//
+// goose doesn't link any drivers itself; the goose binary registers them
+// in build-tagged files, see cmd/goose.
+func RegisterDriver(name string, open DialectorFunc, dialect string) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[name] = driver{open: open, dialect: dialect}
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupDriver(name string) (driver, error) {
+	driversMu.RLock()
+	d, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return driver{}, fmt.Errorf("%q: unknown driver, registered drivers: %v", name, Drivers())
+	}
+	return d, nil
+}
+
+// OpenDBWithDriver sets the dialect of the registered driver and opens a
+// connection to dsn with it.
+func OpenDBWithDriver(name, dsn string) (*gorm.DB, error) {
+	d, err := lookupDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetDialect(d.dialect); err != nil {
+		return nil, err
+	}
+	return openDB(d, dsn)
+}
+
+// OpenDB opens a connection to dsn with the registered driver, leaving the
+// dialect alone. Unlike OpenDBWithDriver, it is safe to call concurrently.
+func OpenDB(name, dsn string) (*gorm.DB, error) {
+	d, err := lookupDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	return openDB(d, dsn)
+}
+
+func openDB(d driver, dsn string) (*gorm.DB, error) {
+	logLevel := logger.Silent
+	if verbose {
+		logLevel = logger.Info
+	}
+	return gorm.Open(d.open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logLevel)})
+}
@@ -0,0 +1,34 @@
+package goose
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+)
+
+func TestOpenDBWithDriver(t *testing.T) {
+	prevDialect, prevDialectName := dialect, dialectName
+	defer func() { dialect, dialectName = prevDialect, prevDialectName }()
+
+	if _, err := OpenDBWithDriver("no-such-driver", ""); err == nil {
+		t.Fatal("expected an error for an unknown driver")
+	}
+
+	RegisterDriver("test-sqlite3", sqlite.Open, "sqlite3")
+	db, err := OpenDBWithDriver("test-sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	if _, ok := GetDialect().(*Sqlite3Dialect); !ok {
+		t.Errorf("unexpected dialect, got %T, want *Sqlite3Dialect", GetDialect())
+	}
+	if err := sqlDB.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/ottomillrath/goose/v2"
 
 	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
 var (
@@ -23,18 +22,15 @@ func main() {
 	flags.Parse(os.Args[1:])
 	args := flags.Args()
 
-	if len(args) < 2 {
+	if len(args) < 3 {
 		flags.Usage()
 		return
 	}
 
-	dbstring, command := args[1], args[3]
+	dbstring, command := args[1], args[2]
 
-	err := goose.SetDialect("sqlite3")
-	if err != nil {
-		log.Fatalf("goose: failed to set dialect: %v\n", err)
-	}
-	db, err := gorm.Open(sqlite.Open(dbstring), &gorm.Config{})
+	goose.RegisterDriver("sqlite3", sqlite.Open, "sqlite3")
+	db, err := goose.OpenDBWithDriver("sqlite3", dbstring)
 	if err != nil {
 		log.Fatalf("goose: failed to open DB: %v\n", err)
 	}
@@ -8,3 +8,5 @@ require (
 	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.8
 )
+
+replace github.com/ottomillrath/goose/v2 => ../
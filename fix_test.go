@@ -21,8 +21,8 @@ func TestFix(t *testing.T) {
 	defer os.RemoveAll(dir)            // clean up
 	defer os.Remove("./bin/fix-goose") // clean up
 
+	goBuild(t, "cmd/goose", ".", "../../bin/fix-goose")
 	commands := []string{
-		"go build -o ./bin/fix-goose ./cmd/goose",
 		fmt.Sprintf("./bin/fix-goose -dir=%s create create_table", dir),
 		fmt.Sprintf("./bin/fix-goose -dir=%s create add_users", dir),
 		fmt.Sprintf("./bin/fix-goose -dir=%s create add_indices", dir),
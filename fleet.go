@@ -0,0 +1,333 @@
+package goose
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// FleetTarget is one database of a fleet.
+type FleetTarget struct {
+	Driver string
+	DSN    string
+}
+
+// String returns the target with any password in the DSN masked.
+func (t FleetTarget) String() string {
+	return t.Driver + " " + redactDSN(t.DSN)
+}
+
+// FleetTargetsFromFile reads fleet targets from path, one "DRIVER DSN" pair
+// per line. Empty lines and lines starting with '#' are ignored.
+func FleetTargetsFromFile(path string) ([]FleetTarget, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open fleet file")
+	}
+	defer f.Close()
+
+	var targets []FleetTarget
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.IndexAny(line, " \t")
+		if idx < 0 {
+			return nil, errors.Errorf("%s:%d: must be of form: DRIVER DSN", path, n)
+		}
+		targets = append(targets, FleetTarget{
+			Driver: line[:idx],
+			DSN:    strings.TrimSpace(line[idx:]),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read fleet file")
+	}
+	return targets, nil
+}
+
+// FleetOptions configures RunFleet.
+type FleetOptions struct {
+	// Open connects to a target. It is required, since goose itself does
+	// not link any database drivers.
+	Open     func(driver, dsn string) (*gorm.DB, error)
+	Parallel int           // number of targets run concurrently, defaults to 1
+	Timeout  time.Duration // per-target timeout, 0 means none
+}
+
+// FleetResult is the outcome of a command for a single target.
+type FleetResult struct {
+	Target  FleetTarget
+	Version int64
+	Err     error
+}
+
+// FleetReport holds the results of RunFleet, in the order of the targets.
+type FleetReport []FleetResult
+
+// Failed returns the number of targets that failed.
+func (r FleetReport) Failed() int {
+	n := 0
+	for _, res := range r {
+		if res.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Print logs a consolidated table of versions and failures to the logger
+// of db, or the package logger if db is nil.
+func (r FleetReport) Print(db *gorm.DB) {
+	logFor(db).Println("    Version          Target")
+	logFor(db).Println("    =======================================================")
+	for _, res := range r {
+		if res.Err != nil {
+			logFor(db).Printf("    %-16s %v\n", "FAILED", res.Target)
+			logFor(db).Printf("    %-16s %v\n", "", res.Err)
+		} else {
+			logFor(db).Printf("    %-16d %v\n", res.Version, res.Target)
+		}
+	}
+	logFor(db).Printf("    %d targets, %d failed\n", len(r), r.Failed())
+}
+
+// RunFleet runs a goose command against every target. Targets are opened
+// with opts.Open, at most opts.Parallel at a time, so it must not change the
+// dialect; OpenDB doesn't. Since the dialect is global, targets are grouped
+// by the dialect their driver is registered with, or by driver if it isn't
+// registered, and each group runs with that dialect; the previous dialect is
+// restored afterwards. For the same reason, RunFleet must not run
+// concurrently with other goose calls in the process.
+//
+// If targets run in parallel, the output of every target is buffered and
+// logged in the order of the targets; verbose output isn't buffered.
+//
+// All targets are run even if some fail. The returned error is non-nil if
+// any target failed.
+func RunFleet(command string, targets []FleetTarget, service, dir string, opts FleetOptions, args ...string) (FleetReport, error) {
+	switch command {
+	case "create", "fix":
+		return nil, fmt.Errorf("%q cannot be run against a fleet", command)
+	}
+	if opts.Open == nil {
+		return nil, errors.New("no fleet opener given")
+	}
+
+	// Validate the migrations once up front, rather than once per target.
+	if _, err := CollectMigrations(service, dir, minVersion, maxVersion); err != nil {
+		return nil, err
+	}
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	prevDialect, prevDialectName := dialect, dialectName
+	defer func() { dialect, dialectName = prevDialect, prevDialectName }()
+
+	out := newFleetOutput(len(targets), parallel > 1)
+	report := make(FleetReport, len(targets))
+	dialects := fleetDialects(targets)
+	for _, d := range distinct(dialects) {
+		if err := SetDialect(d); err != nil {
+			for i, t := range targets {
+				if dialects[i] == d {
+					report[i] = FleetResult{Target: t, Err: err}
+					out.done(i)
+				}
+			}
+			continue
+		}
+
+		var (
+			jobs = make(chan int)
+			wg   sync.WaitGroup
+		)
+		for w := 0; w < parallel; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					report[i] = runFleetTarget(command, targets[i], service, dir, opts, out.logger(i), args...)
+					out.done(i)
+				}
+			}()
+		}
+		for i := range targets {
+			if dialects[i] == d {
+				jobs <- i
+			}
+		}
+		close(jobs)
+		wg.Wait()
+	}
+
+	if n := report.Failed(); n > 0 {
+		return report, fmt.Errorf("%d of %d targets failed", n, len(report))
+	}
+	return report, nil
+}
+
+// fleetDialects returns the dialect of every target: the one its driver is
+// registered with, or the driver name if it isn't registered.
+func fleetDialects(targets []FleetTarget) []string {
+	dialects := make([]string, len(targets))
+	for i, t := range targets {
+		dialects[i] = t.Driver
+		if d, err := lookupDriver(t.Driver); err == nil {
+			dialects[i] = d.dialect
+		}
+	}
+	return dialects
+}
+
+// distinct returns the distinct names in order of appearance.
+func distinct(names []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func runFleetTarget(command string, target FleetTarget, service, dir string, opts FleetOptions, l Logger, args ...string) FleetResult {
+	res := FleetResult{Target: target}
+
+	db, err := opts.Open(target.Driver, target.DSN)
+	if err != nil {
+		res.Err = errors.Wrap(err, "failed to open DB")
+		return res
+	}
+	defer func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	db = withLogger(db.WithContext(ctx), l)
+
+	l.Printf("goose: %v: %s\n", target, command)
+	if err := Run(command, db, service, dir, args...); err != nil {
+		res.Err = err
+	}
+
+	version, err := appliedVersion(db, service)
+	if err != nil && res.Err == nil {
+		res.Err = err
+	}
+	res.Version = version
+	return res
+}
+
+// fleetOutput logs the output of fleet targets in the order of the targets.
+// If buffered, the output of a target is held until it and all targets
+// before it are done.
+type fleetOutput struct {
+	mu      sync.Mutex
+	buffers []*fleetBuffer
+	next    int // first target not yet done
+	isDone  []bool
+}
+
+func newFleetOutput(n int, buffered bool) *fleetOutput {
+	o := &fleetOutput{isDone: make([]bool, n)}
+	if buffered {
+		o.buffers = make([]*fleetBuffer, n)
+		for i := range o.buffers {
+			o.buffers[i] = &fleetBuffer{}
+		}
+	}
+	return o
+}
+
+// logger returns the logger of target i.
+func (o *fleetOutput) logger(i int) Logger {
+	if o.buffers == nil {
+		return log
+	}
+	return o.buffers[i]
+}
+
+// done marks target i as done and logs the output of the targets whose
+// turn it is.
+func (o *fleetOutput) done(i int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.isDone[i] = true
+	for ; o.next < len(o.isDone) && o.isDone[o.next]; o.next++ {
+		if o.buffers != nil {
+			o.buffers[o.next].flush()
+		}
+	}
+}
+
+// fleetBuffer holds the output of a target until it is flushed. Output
+// after that, like from a lock heartbeat, is logged right away.
+type fleetBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	flushed bool
+}
+
+func (b *fleetBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.flushed {
+		log.Print(line)
+		return
+	}
+	b.lines = append(b.lines, line)
+}
+
+func (b *fleetBuffer) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, line := range b.lines {
+		log.Print(line)
+	}
+	b.lines, b.flushed = nil, true
+}
+
+func (b *fleetBuffer) Fatal(v ...interface{})                 { b.flush(); log.Fatal(v...) }
+func (b *fleetBuffer) Fatalf(format string, v ...interface{}) { b.flush(); log.Fatalf(format, v...) }
+func (b *fleetBuffer) Print(v ...interface{})                 { b.add(fmt.Sprint(v...)) }
+func (b *fleetBuffer) Println(v ...interface{})               { b.add(fmt.Sprintln(v...)) }
+func (b *fleetBuffer) Printf(format string, v ...interface{}) { b.add(fmt.Sprintf(format, v...)) }
+
+var (
+	matchDSNPassword = regexp.MustCompile(`(password=)(\S+)`)
+	matchDSNUserPass = regexp.MustCompile(`^([^:@/]+):([^@]*)@`)
+)
+
+// redactDSN masks the password of URL, key=value and MySQL style DSNs.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	dsn = matchDSNPassword.ReplaceAllString(dsn, "${1}xxxxx")
+	return matchDSNUserPass.ReplaceAllString(dsn, "${1}:xxxxx@")
+}
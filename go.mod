@@ -4,5 +4,6 @@ go 1.16
 
 require (
 	github.com/pkg/errors v0.9.1
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.8
 )
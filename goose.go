@@ -1,9 +1,11 @@
 package goose
 
 import (
+	"database/sql"
 	"fmt"
 	"strconv"
 
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
@@ -21,8 +23,44 @@ func SetVerbose(v bool) {
 	verbose = v
 }
 
+// lockedCommands apply or roll back migrations, so Run holds the lock of
+// dialects implementing Locker while running them.
+var lockedCommands = map[string]bool{
+	"up":        true,
+	"up-by-one": true,
+	"up-to":     true,
+	"down":      true,
+	"down-to":   true,
+	"redo":      true,
+	"reset":     true,
+}
+
 // Run runs a goose command.
 func Run(command string, db *gorm.DB, service, dir string, args ...string) error {
+	if db == nil || !lockedCommands[command] {
+		return run(command, db, service, dir, args...)
+	}
+
+	if locker, ok := GetDialect().(Locker); ok {
+		if err := locker.Lock(db, service); err != nil {
+			return errors.Wrap(err, "failed to lock migrations")
+		}
+		defer func() {
+			if err := locker.Unlock(db, service); err != nil {
+				logFor(db).Printf("goose: %v\n", err)
+			}
+		}()
+	}
+
+	if p, ok := GetDialect().(SessionPreparer); ok {
+		return withSession(db, p.SessionSQL(), func(db *gorm.DB) error {
+			return run(command, db, service, dir, args...)
+		})
+	}
+	return run(command, db, service, dir, args...)
+}
+
+func run(command string, db *gorm.DB, service, dir string, args ...string) error {
 	switch command {
 	case "up":
 		if err := Up(db, service, dir); err != nil {
@@ -88,12 +126,76 @@ func Run(command string, db *gorm.DB, service, dir string, args ...string) error
 		if err := Status(db, service, dir); err != nil {
 			return err
 		}
+	case "lint":
+		if err := runLint(dir); err != nil {
+			return err
+		}
+	case "validate":
+		if err := Validate(service, dir); err != nil {
+			return err
+		}
+	case "check-dialects":
+		if err := CheckDialects(dir, args); err != nil {
+			return err
+		}
 	case "version":
 		if err := Version(db, service, dir); err != nil {
 			return err
 		}
+	case "background":
+		if len(args) == 0 {
+			return fmt.Errorf("background must be of form: goose [OPTIONS] DRIVER DBSTRING background run|status")
+		}
+		switch args[0] {
+		case "run":
+			if err := RunBackground(db, service, dir); err != nil {
+				return err
+			}
+		case "status":
+			if err := BackgroundStatus(db, service); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("background %q: no such command, must be run or status", args[0])
+		}
 	default:
 		return fmt.Errorf("%q: no such command", command)
 	}
 	return nil
 }
+
+// withSession calls fn with a session of db bound to a single connection,
+// after running the statements of prepare on that connection.
+func withSession(db *gorm.DB, prepare []string, fn func(db *gorm.DB) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(db.Statement.Context)
+	if err != nil {
+		return errors.Wrap(err, "failed to get connection")
+	}
+	defer conn.Close()
+
+	for _, query := range prepare {
+		if _, err := conn.ExecContext(db.Statement.Context, query); err != nil {
+			return errors.Wrapf(err, "failed to prepare session: %q", query)
+		}
+	}
+	return fn(bindConn(db, conn))
+}
+
+// boundToConn reports whether db runs all queries on a single connection,
+// like the sessions of bindConn.
+func boundToConn(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(*sql.Conn)
+	return ok
+}
+
+// bindConn returns a session of db that runs all queries on conn.
+func bindConn(db *gorm.DB, conn *sql.Conn) *gorm.DB {
+	sdb := db.Session(&gorm.Session{Context: db.Statement.Context, NewDB: true})
+	sdb.Statement.ConnPool = conn
+	sdb.Config.ConnPool = conn
+	return sdb
+}
@@ -12,8 +12,8 @@ import (
 func TestDefaultBinary(t *testing.T) {
 	t.Parallel()
 
+	goBuild(t, "cmd/goose", ".", "../../bin/goose")
 	commands := []string{
-		"go build -o ./bin/goose ./cmd/goose",
 		"./bin/goose -dir=examples/sql-migrations sqlite3 sql.db up",
 		"./bin/goose -dir=examples/sql-migrations sqlite3 sql.db version",
 		"./bin/goose -dir=examples/sql-migrations sqlite3 sql.db down",
@@ -50,13 +50,7 @@ func TestLiteBinary(t *testing.T) {
 	defer os.RemoveAll(dir)             // clean up
 	defer os.Remove("./bin/lite-goose") // clean up
 
-	// this has to be done outside of the loop
-	// since go only supports space separated tags list.
-	cmd := exec.Command("go", "build", "-tags='no_postgres no_mysql no_sqlite3'", "-o", "./bin/lite-goose", "./cmd/goose")
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		t.Fatalf("%s:\n%v\n\n%s", err, cmd, out)
-	}
+	goBuild(t, "cmd/goose", ".", "../../bin/lite-goose", "-tags=no_postgres no_mysql no_sqlite3")
 
 	commands := []string{
 		fmt.Sprintf("./bin/lite-goose -dir=%s create user_indices sql", dir),
@@ -77,8 +71,8 @@ func TestLiteBinary(t *testing.T) {
 func TestCustomBinary(t *testing.T) {
 	t.Parallel()
 
+	goBuild(t, "examples", "./go-migrations", "../bin/custom-goose")
 	commands := []string{
-		"go build -o ./bin/custom-goose ./examples/go-migrations",
 		"./bin/custom-goose -dir=examples/go-migrations sqlite3 go.db up",
 		"./bin/custom-goose -dir=examples/go-migrations sqlite3 go.db version",
 		"./bin/custom-goose -dir=examples/go-migrations sqlite3 go.db down",
@@ -93,3 +87,13 @@ func TestCustomBinary(t *testing.T) {
 		}
 	}
 }
+
+// goBuild builds pkg of the module in dir into out, both relative to dir.
+func goBuild(t *testing.T, dir, pkg, out string, flags ...string) {
+	args := append([]string{"build"}, flags...)
+	cmd := exec.Command("go", append(args, "-o", out, pkg)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s:\n%v\n\n%s", err, cmd, out)
+	}
+}
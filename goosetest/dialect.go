@@ -0,0 +1,178 @@
+package goosetest
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ottomillrath/goose/v2"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// dialectTestService is the service the dialect tests record versions for,
+// reserved for them: its migrations are only those of the suite.
+const dialectTestService = "goosetest.RunDialectTests"
+
+// dialectTestMigrations don't touch the schema, so the dialect tests only
+// exercise the version table and run on any database.
+var dialectTestMigrations = map[string]string{
+	"00001_first.sql": `-- +goose Up
+-- +goose Description: first
+SELECT 1;
+-- +goose Down
+SELECT 1;
+`,
+	"00002_second.sql": `-- +goose Up
+SELECT 1;
+-- +goose Down
+SELECT 1;
+`,
+}
+
+// RunDialectTests is the conformance suite for a goose.Dialect. It sets the
+// dialect registered as name and checks that goose can create the version
+// table in db, which must not exist yet, and apply, inspect and roll back
+// migrations with it.
+//
+// Third-party dialects run it against a test database:
+//
+//	func TestDialect(t *testing.T) {
+//		goose.RegisterDialect("mydb", &MyDialect{})
+//		goosetest.RunDialectTests(t, openTestDB(t), "mydb")
+//	}
+func RunDialectTests(t *testing.T, db *gorm.DB, name string) {
+	if err := goose.SetDialect(name); err != nil {
+		t.Fatal(err)
+	}
+	d := goose.GetDialect()
+
+	dir, err := ioutil.TempDir("", "goosetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+	for file, content := range dialectTestMigrations {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := dialectTestService
+	if err := checkNoGoMigrations(service, dir); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"CreateVersionTable", func(t *testing.T) {
+			version, err := goose.EnsureDBVersion(db, service)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != 0 {
+				t.Fatalf("unexpected version of new table, got %d, want 0", version)
+			}
+			// The table exists now, so it must not be created again.
+			if _, err := goose.EnsureDBVersion(db, service); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"Up", func(t *testing.T) {
+			if err := goose.Up(db, service, dir); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(t, db, service, 2)
+		}},
+		{"MigrationSQL", func(t *testing.T) {
+			tstamp, applied, description, err := latestRow(db, d, service, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !applied {
+				t.Error("version 1 is not applied")
+			}
+			if tstamp.IsZero() {
+				t.Error("version 1 has no tstamp")
+			}
+			if description != "first" {
+				t.Errorf("unexpected description of version 1, got %q, want %q", description, "first")
+			}
+		}},
+		{"Status", func(t *testing.T) {
+			if err := goose.Status(db, service, dir); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"Down", func(t *testing.T) {
+			if err := goose.Down(db, service, dir); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(t, db, service, 1)
+
+			_, applied, _, err := latestRow(db, d, service, 2)
+			if err != nil && err != sql.ErrNoRows {
+				t.Fatal(err)
+			}
+			if applied {
+				t.Error("version 2 is still applied")
+			}
+		}},
+		{"Redo", func(t *testing.T) {
+			if err := goose.Redo(db, service, dir); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(t, db, service, 1)
+		}},
+		{"Reset", func(t *testing.T) {
+			if err := goose.Reset(db, service, dir); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(t, db, service, 0)
+		}},
+	}
+
+	for _, step := range steps {
+		if !t.Run(step.name, step.run) {
+			// Later steps depend on the state left by earlier ones.
+			return
+		}
+	}
+}
+
+// checkNoGoMigrations fails if Go migrations are registered for service,
+// which would run along with the SQL migrations in dir.
+func checkNoGoMigrations(service, dir string) error {
+	migrations, err := goose.CollectMigrations(service, dir, 0, goose.MaxVersion)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if filepath.Ext(m.Source) == ".go" {
+			return errors.Errorf("goosetest: Go migration %s is registered for service %q, which RunDialectTests reserves for its own migrations", m.Source, service)
+		}
+	}
+	return nil
+}
+
+func expectVersion(t *testing.T, db *gorm.DB, service string, want int64) {
+	t.Helper()
+	version, err := goose.GetDBVersion(db, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != want {
+		t.Errorf("unexpected version, got %d, want %d", version, want)
+	}
+}
+
+// latestRow runs the MigrationSQL query of d for version.
+func latestRow(db *gorm.DB, d goose.Dialect, service string, version int64) (tstamp time.Time, applied bool, description string, err error) {
+	var desc sql.NullString
+	err = db.Statement.ConnPool.QueryRowContext(db.Statement.Context, d.MigrationSQL(service), version).Scan(&tstamp, &applied, &desc)
+	return tstamp, applied, desc.String, err
+}
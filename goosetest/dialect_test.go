@@ -0,0 +1,47 @@
+package goosetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/gorm"
+)
+
+func TestSqlite3Dialect(t *testing.T) {
+	RunDialectTests(t, openSQLite(t), "sqlite3")
+}
+
+// customDialect is registered from outside the goose package, like a
+// third-party dialect would be.
+type customDialect struct {
+	goose.Sqlite3Dialect
+}
+
+func TestRegisteredDialect(t *testing.T) {
+	goose.RegisterDialect("goosetest-custom", &customDialect{})
+	RunDialectTests(t, openSQLite(t), "goosetest-custom")
+}
+
+func TestCheckNoGoMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	service := "goosetest-reserved"
+	if err := checkNoGoMigrations(service, dir); err != nil {
+		t.Fatal(err)
+	}
+	noop := func(*gorm.DB) error { return nil }
+	if err := goose.AddNamedMigration(service, filepath.Join(dir, "00003_stray.go"), noop, noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNoGoMigrations(service, dir); err == nil || !strings.Contains(err.Error(), "00003_stray.go is registered") {
+		t.Errorf("expected the registered Go migration to be refused, got %v", err)
+	}
+}
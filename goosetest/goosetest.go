@@ -0,0 +1,232 @@
+// Package goosetest checks from Go tests that migrations can be rolled back.
+//
+// For every migration, in order, RoundTrip snapshots the schema, runs Up,
+// Down and Up again, and compares the schema before the first Up with the
+// schema after Down. A difference means the Down of that migration does not
+// reverse its Up. Both SQL migrations and registered Go migrations are run.
+//
+// A typical test uses an in-memory SQLite database:
+//
+//	func TestMigrations(t *testing.T) {
+//		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		goosetest.RoundTrip(t, db, "default", "./migrations")
+//	}
+package goosetest
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ottomillrath/goose/v2"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Failure is a migration that failed to round-trip.
+type Failure struct {
+	Migration string   // file name of the migration
+	Step      string   // "up", "down" or "up again"
+	Err       error    // set if the step failed to run
+	Missing   []string // schema objects Down did not restore
+	Extra     []string // schema objects Down did not remove
+}
+
+func (f *Failure) Error() string {
+	if f.Err != nil {
+		return fmt.Sprintf("%s: %s failed: %v", f.Migration, f.Step, f.Err)
+	}
+
+	lines := []string{fmt.Sprintf("%s: Down does not reverse Up", f.Migration)}
+	for _, s := range f.Missing {
+		lines = append(lines, "    - "+s)
+	}
+	for _, s := range f.Extra {
+		lines = append(lines, "    + "+s)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RoundTrip runs Check and reports every failure to t.
+func RoundTrip(t testing.TB, db *gorm.DB, service, dir string) {
+	t.Helper()
+
+	failures, err := Check(db, service, dir)
+	if err != nil {
+		t.Fatalf("goosetest: %v", err)
+	}
+	for _, f := range failures {
+		t.Errorf("goosetest: %v", f)
+	}
+}
+
+// Check runs Up, Down and Up again for every migration of service in dir
+// against db, which should start out empty. The goose dialect is set from
+// the gorm dialector of db.
+//
+// A migration that fails to run stops the check, since later migrations
+// depend on it. Down steps that don't restore the schema are collected and
+// the check continues as long as Up can be run again. The returned error is
+// for problems unrelated to a single migration, like a missing directory.
+func Check(db *gorm.DB, service, dir string) ([]*Failure, error) {
+	if err := setDialect(db); err != nil {
+		return nil, err
+	}
+
+	migrations, err := goose.CollectMigrations(service, dir, 0, goose.MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := goose.EnsureDBVersion(db, service); err != nil {
+		return nil, errors.Wrap(err, "failed to create version table")
+	}
+
+	var failures []*Failure
+	for _, m := range migrations {
+		name := filepath.Base(m.Source)
+
+		before, err := Snapshot(db)
+		if err != nil {
+			return failures, err
+		}
+
+		if err := m.Up(db); err != nil {
+			return append(failures, &Failure{Migration: name, Step: "up", Err: err}), nil
+		}
+		if err := m.Down(db); err != nil {
+			return append(failures, &Failure{Migration: name, Step: "down", Err: err}), nil
+		}
+
+		after, err := Snapshot(db)
+		if err != nil {
+			return failures, err
+		}
+		missing, extra := diff(before, after)
+		reversed := len(missing) == 0 && len(extra) == 0
+		if !reversed {
+			failures = append(failures, &Failure{Migration: name, Step: "down", Missing: missing, Extra: extra})
+		}
+
+		if err := m.Up(db); err != nil {
+			if !reversed {
+				// Up most likely failed on what Down left behind, which
+				// was reported already.
+				return failures, nil
+			}
+			return append(failures, &Failure{Migration: name, Step: "up again", Err: err}), nil
+		}
+	}
+
+	return failures, nil
+}
+
+// setDialect points goose at the dialect matching the gorm dialector.
+func setDialect(db *gorm.DB) error {
+	switch name := db.Dialector.Name(); name {
+	case "sqlite":
+		return goose.SetDialect("sqlite3")
+	case "sqlserver":
+		return goose.SetDialect("mssql")
+	default:
+		return goose.SetDialect(name)
+	}
+}
+
+// Snapshot returns a sorted, one line per object description of the tables,
+// columns and indexes of db, excluding the tables goose keeps its state in.
+func Snapshot(db *gorm.DB) ([]string, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		query = `SELECT type || ' ' || name || ': ' || COALESCE(sql, '')
+			FROM sqlite_master
+			WHERE name NOT LIKE 'sqlite_%' AND tbl_name NOT IN (?, ?, ?, ?, ?)`
+	case "postgres":
+		query = `SELECT 'column ' || table_name || '.' || column_name || ': ' || data_type || ' ' || is_nullable || ' ' || COALESCE(column_default, '')
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name NOT IN ($1, $2, $3, $4, $5)
+			UNION ALL
+			SELECT 'index ' || indexname || ': ' || indexdef
+			FROM pg_indexes
+			WHERE schemaname = current_schema() AND tablename NOT IN ($1, $2, $3, $4, $5)`
+	case "duckdb":
+		query = `SELECT 'column ' || table_name || '.' || column_name || ': ' || data_type || ' ' || is_nullable || ' ' || COALESCE(column_default, '')
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name NOT IN ($1, $2, $3, $4, $5)
+			UNION ALL
+			SELECT 'index ' || index_name || ': ' || COALESCE(sql, '')
+			FROM duckdb_indexes()
+			WHERE schema_name = current_schema() AND table_name NOT IN ($1, $2, $3, $4, $5)`
+	case "mysql":
+		query = `SELECT CONCAT('column ', table_name, '.', column_name, ': ', column_type, ' ', is_nullable, ' ', COALESCE(column_default, ''))
+			FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name NOT IN (?, ?, ?, ?, ?)
+			UNION ALL
+			SELECT CONCAT('index ', table_name, '.', index_name, ': ', GROUP_CONCAT(column_name ORDER BY seq_in_index))
+			FROM information_schema.statistics
+			WHERE table_schema = DATABASE() AND table_name NOT IN (?, ?, ?, ?, ?)
+			GROUP BY table_name, index_name`
+	case "sqlserver":
+		query = `SELECT CONCAT('column ', table_name, '.', column_name, ': ', data_type, ' ', is_nullable, ' ', COALESCE(column_default, ''))
+			FROM information_schema.columns
+			WHERE table_schema = SCHEMA_NAME() AND table_name NOT IN (@p1, @p2, @p3, @p4, @p5)`
+	default:
+		return nil, errors.Errorf("%q: schema snapshots are not supported", db.Dialector.Name())
+	}
+
+	// The dirty state of NO TRANSACTION migrations, the background jobs,
+	// the meta-version and the CockroachDB lock are kept next to the version
+	// table.
+	_, table := goose.VersionTable()
+	args := []interface{}{table, table + "_dirty", table + "_background", table + "_meta", table + "_lock"}
+	if db.Dialector.Name() == "mysql" {
+		args = append(args, args...)
+	}
+
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to snapshot schema")
+	}
+	defer rows.Close()
+
+	var schema []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, errors.Wrap(err, "failed to scan schema")
+		}
+		schema = append(schema, strings.Join(strings.Fields(s), " "))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to scan schema")
+	}
+
+	sort.Strings(schema)
+	return schema, nil
+}
+
+// diff returns the lines of the sorted before that are not in after, and
+// the other way round.
+func diff(before, after []string) (missing, extra []string) {
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || (i < len(before) && before[i] < after[j]):
+			missing = append(missing, before[i])
+			i++
+		case i == len(before) || after[j] < before[i]:
+			extra = append(extra, after[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return missing, extra
+}
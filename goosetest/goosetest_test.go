@@ -0,0 +1,99 @@
+package goosetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ottomillrath/goose/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a new database.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestRoundTripExamples(t *testing.T) {
+	RoundTrip(t, openSQLite(t), "default", "../examples/sql-migrations")
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	files := map[string]string{
+		"00001_create_users.sql": `-- +goose Up
+CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);
+-- +goose Down
+DROP TABLE users;
+`,
+		"00002_add_index.sql": `-- +goose Up
+CREATE INDEX IF NOT EXISTS users_email ON users (email);
+-- +goose Down
+SELECT 1;
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := "goosetest-check"
+	up := func(tx *gorm.DB) error {
+		return tx.Exec("CREATE TABLE posts (id INTEGER PRIMARY KEY)").Error
+	}
+	down := func(tx *gorm.DB) error {
+		return tx.Exec("DROP TABLE posts").Error
+	}
+	if err := goose.AddNamedMigration(service, filepath.Join(dir, "00003_create_posts.go"), up, down); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openSQLite(t)
+	failures, err := Check(db, service, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 failure, got %v", failures)
+	}
+	f := failures[0]
+	if f.Migration != "00002_add_index.sql" || len(f.Missing) != 0 || len(f.Extra) != 1 || !strings.HasPrefix(f.Extra[0], "index users_email") {
+		t.Errorf("unexpected failure: %v", f)
+	}
+
+	// every migration ends up applied
+	version, err := goose.GetDBVersion(db, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("unexpected version, got %v, want 3", version)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	missing, extra := diff([]string{"a", "b", "d"}, []string{"b", "c", "d", "e"})
+	if !reflect.DeepEqual(missing, []string{"a"}) || !reflect.DeepEqual(extra, []string{"c", "e"}) {
+		t.Errorf("unexpected diff, got missing=%v extra=%v", missing, extra)
+	}
+}
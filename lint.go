@@ -0,0 +1,322 @@
+package goose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LintSeverity is the severity of a lint rule.
+type LintSeverity string
+
+const (
+	// LintError issues make Lint fail.
+	LintError LintSeverity = "error"
+	// LintWarning issues are only reported.
+	LintWarning LintSeverity = "warning"
+)
+
+// LintConfig configures which rules Lint checks and how severe they are.
+type LintConfig struct {
+	Enable   []string                // rules to turn on, including ones off by default
+	Disable  []string                // rules to turn off
+	Severity map[string]LintSeverity // severity overrides by rule
+}
+
+// LintIssue is a risky statement found by Lint.
+type LintIssue struct {
+	File      string
+	Line      int // first line of the statement in the file
+	Statement int // 1-based index of the statement in the Up section
+	Rule      string
+	Severity  LintSeverity
+	Message   string
+	SQL       string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d: statement %d: %s [%s]: %s: %s", i.File, i.Line, i.Statement, i.Severity, i.Rule, i.Message, excerpt(i.SQL, 60))
+}
+
+type lintRule struct {
+	name     string
+	severity LintSeverity
+	disabled bool     // off unless enabled in LintConfig
+	dialects []string // dialects the rule applies to, all if empty
+	message  string
+	match    func(stmt string) bool // stmt is normalized, see normalizeStatement
+}
+
+var (
+	matchDropTable   = regexp.MustCompile(`^DROP TABLE\b`)
+	matchDropColumn  = regexp.MustCompile(`^ALTER TABLE .*\bDROP COLUMN\b`)
+	matchAlterTypePg = regexp.MustCompile(`^ALTER TABLE .*\bALTER (COLUMN )?\S+ (SET DATA )?TYPE\b`)
+	matchAlterTypeMy = regexp.MustCompile(`^ALTER TABLE .*\b(MODIFY|CHANGE)\b`)
+	matchAlterTypeMs = regexp.MustCompile(`^ALTER TABLE .*\bALTER COLUMN \S+ (\S+)`)
+	matchAddColumn   = regexp.MustCompile(`^ADD (COLUMN )?`)
+	matchCreateIndex = regexp.MustCompile(`^CREATE (UNIQUE )?INDEX\b`)
+	matchRenameCol   = regexp.MustCompile(`^ALTER TABLE .*\bRENAME (COLUMN \S+|\S+) TO\b|^EXEC(UTE)? SP_RENAME .*'COLUMN'`)
+	matchRenameTable = regexp.MustCompile(`^ALTER TABLE \S+ RENAME TO\b|^RENAME TABLE\b|^EXEC(UTE)? SP_RENAME\b`)
+)
+
+var lintRules = []lintRule{
+	{
+		name:     "drop-table",
+		severity: LintError,
+		message:  "dropping a table loses data",
+		match:    matchDropTable.MatchString,
+	},
+	{
+		name:     "drop-column",
+		severity: LintError,
+		message:  "dropping a column loses data and breaks running code that reads it",
+		match:    matchDropColumn.MatchString,
+	},
+	{
+		name:     "alter-column-type",
+		severity: LintWarning,
+		message:  "changing a column type may rewrite the table and break running code",
+		match: func(stmt string) bool {
+			if m, ok := GetDialect().(ColumnTypeAlterMatcher); ok {
+				return m.AltersColumnType(stmt)
+			}
+			return matchAlterTypePg.MatchString(stmt)
+		},
+	},
+	{
+		name:     "not-null-without-default",
+		severity: LintError,
+		message:  "adding a NOT NULL column without a default fails on non-empty tables",
+		match: func(stmt string) bool {
+			if !strings.HasPrefix(stmt, "ALTER TABLE ") {
+				return false
+			}
+			for _, clause := range alterTableClauses(stmt) {
+				if matchAddColumn.MatchString(clause) && strings.Contains(clause, "NOT NULL") && !strings.Contains(clause, "DEFAULT") {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		name:     "create-index-not-concurrently",
+		severity: LintWarning,
+		dialects: []string{"postgres"},
+		message:  "CREATE INDEX without CONCURRENTLY locks the table against writes",
+		match: func(stmt string) bool {
+			return matchCreateIndex.MatchString(stmt) && !strings.Contains(stmt, " CONCURRENTLY ")
+		},
+	},
+	{
+		name:     "rename-column",
+		severity: LintWarning,
+		message:  "renaming a column breaks running code that uses the old name",
+		match:    matchRenameCol.MatchString,
+	},
+	{
+		name:     "rename-table",
+		severity: LintWarning,
+		disabled: true,
+		message:  "renaming a table breaks running code that uses the old name",
+		match: func(stmt string) bool {
+			return matchRenameTable.MatchString(stmt) && !matchRenameCol.MatchString(stmt)
+		},
+	},
+}
+
+var lintConfig LintConfig
+
+// SetLintConfig sets the configuration used by the lint command.
+func SetLintConfig(c LintConfig) {
+	lintConfig = c
+}
+
+// Lint statically checks the Up statements of the SQL migrations in dir
+// for risky DDL, using the rules that apply to the current dialect.
+// Statements preceded by '-- +goose lint-ignore RULE[,RULE]' are not
+// checked for those rules. Go migrations are not checked.
+func Lint(dir string, config LintConfig) ([]LintIssue, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s directory does not exist", dir)
+	}
+
+	rules, err := activeLintRules(config)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var issues []LintIssue
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		statements, _, err := parseSQLStatements(f, true)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", filepath.Base(file))
+		}
+
+		for i, stmt := range statements {
+			normalized := normalizeStatement(stmt.SQL)
+			for _, rule := range rules {
+				if containsString(stmt.LintIgnore, rule.name) || !rule.match(normalized) {
+					continue
+				}
+				issues = append(issues, LintIssue{
+					File:      file,
+					Line:      stmt.Line,
+					Statement: i + 1,
+					Rule:      rule.name,
+					Severity:  rule.severity,
+					Message:   rule.message,
+					SQL:       clearStatement(stmt.SQL),
+				})
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// runLint prints the issues found by Lint and fails if any is an error.
+func runLint(dir string) error {
+	issues, err := Lint(dir, lintConfig)
+	if err != nil {
+		return err
+	}
+
+	errs := 0
+	for _, issue := range issues {
+		log.Println(issue)
+		if issue.Severity == LintError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return errors.Errorf("%d lint error(s) found", errs)
+	}
+	log.Printf("goose: %d lint warning(s) found\n", len(issues))
+	return nil
+}
+
+// activeLintRules applies config to the default rules and keeps those
+// that apply to the current dialect.
+func activeLintRules(config LintConfig) ([]lintRule, error) {
+	known := make(map[string]bool)
+	for _, rule := range lintRules {
+		known[rule.name] = true
+	}
+	for _, names := range [][]string{config.Enable, config.Disable} {
+		for _, name := range names {
+			if !known[name] {
+				return nil, errors.Errorf("%q: unknown lint rule", name)
+			}
+		}
+	}
+
+	for name, severity := range config.Severity {
+		if !known[name] {
+			return nil, errors.Errorf("%q: unknown lint rule", name)
+		}
+		if severity != LintError && severity != LintWarning {
+			return nil, errors.Errorf("%q: unknown lint severity for rule %q", severity, name)
+		}
+	}
+
+	var rules []lintRule
+	for _, rule := range lintRules {
+		if containsString(config.Enable, rule.name) {
+			rule.disabled = false
+		}
+		if containsString(config.Disable, rule.name) {
+			rule.disabled = true
+		}
+		if rule.disabled {
+			continue
+		}
+		if len(rule.dialects) > 0 && !containsString(rule.dialects, dialectName) {
+			continue
+		}
+		if severity, ok := config.Severity[rule.name]; ok {
+			rule.severity = severity
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+var (
+	matchInlineComment = regexp.MustCompile(`--[^\n]*`)
+	matchBlockComment  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	matchWhitespace    = regexp.MustCompile(`\s+`)
+)
+
+// normalizeStatement strips comments, collapses whitespace and upper-cases
+// a statement, so rules can match it with simple patterns.
+func normalizeStatement(s string) string {
+	s = matchBlockComment.ReplaceAllString(s, " ")
+	s = matchInlineComment.ReplaceAllString(s, " ")
+	s = matchWhitespace.ReplaceAllString(s, " ")
+	s = strings.TrimSuffix(strings.TrimSpace(s), ";")
+	return strings.ToUpper(strings.TrimSpace(s)) + " "
+}
+
+var matchAlterTable = regexp.MustCompile(`^ALTER TABLE (IF EXISTS )?(ONLY )?\S+ (.*)$`)
+
+// alterTableClauses splits a normalized ALTER TABLE statement into its
+// comma separated clauses, ignoring commas inside parentheses.
+func alterTableClauses(stmt string) []string {
+	m := matchAlterTable.FindStringSubmatch(stmt)
+	if m == nil {
+		return nil
+	}
+	rest := m[3]
+
+	var clauses []string
+	depth, start := 0, 0
+	for i, r := range rest {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(rest[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, strings.TrimSpace(rest[start:]))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// excerpt shortens a statement to its first n characters on one line.
+func excerpt(s string, n int) string {
+	s = matchWhitespace.ReplaceAllString(strings.TrimSpace(s), " ")
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_risky.sql"), []byte(riskySQL), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type issue struct {
+		Statement int
+		Rule      string
+		Severity  LintSeverity
+	}
+	tt := []struct {
+		dialect string
+		config  LintConfig
+		want    []issue
+	}{
+		{
+			dialect: "postgres",
+			want: []issue{
+				{1, "create-index-not-concurrently", LintWarning},
+				{3, "drop-column", LintError},
+				{4, "not-null-without-default", LintError},
+				{6, "alter-column-type", LintWarning},
+				{7, "rename-column", LintWarning},
+				{10, "drop-table", LintError},
+			},
+		},
+		{
+			dialect: "mysql",
+			config: LintConfig{
+				Enable:   []string{"rename-table"},
+				Disable:  []string{"drop-table"},
+				Severity: map[string]LintSeverity{"drop-column": LintWarning},
+			},
+			want: []issue{
+				{3, "drop-column", LintWarning},
+				{4, "not-null-without-default", LintError},
+				{7, "rename-column", LintWarning},
+				{8, "rename-table", LintWarning},
+			},
+		},
+	}
+
+	for _, test := range tt {
+		if err := SetDialect(test.dialect); err != nil {
+			t.Fatal(err)
+		}
+		issues, err := Lint(dir, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []issue
+		for _, i := range issues {
+			got = append(got, issue{i.Statement, i.Rule, i.Severity})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: unexpected issues\ngot  %v\nwant %v", test.dialect, got, test.want)
+		}
+	}
+	if err := SetDialect("postgres"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Lint(dir, LintConfig{Disable: []string{"no-such-rule"}}); err == nil {
+		t.Error("expected error on unknown rule")
+	}
+}
+
+var riskySQL = `-- +goose Up
+CREATE INDEX users_email ON users (email);
+CREATE INDEX CONCURRENTLY users_name ON users (name);
+ALTER TABLE users DROP COLUMN legacy_id;
+ALTER TABLE users
+    ADD COLUMN status text NOT NULL,
+    ADD COLUMN kind text NOT NULL DEFAULT 'user';
+-- +goose lint-ignore not-null-without-default
+ALTER TABLE users ADD COLUMN created_at timestamp NOT NULL;
+ALTER TABLE users ALTER COLUMN name TYPE varchar(255);
+ALTER TABLE users RENAME COLUMN surname TO last_name;
+ALTER TABLE posts RENAME TO articles;
+-- +goose lint-ignore drop-table, drop-column
+DROP TABLE IF EXISTS tmp_import;
+DROP TABLE old_users;
+
+-- +goose Down
+DROP TABLE users;
+`
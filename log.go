@@ -1,7 +1,10 @@
 package goose
 
 import (
+	"context"
 	std "log"
+
+	"gorm.io/gorm"
 )
 
 var log Logger = &stdLogger{}
@@ -28,3 +31,21 @@ func (*stdLogger) Fatalf(format string, v ...interface{}) { std.Fatalf(format, v
 func (*stdLogger) Print(v ...interface{})                 { std.Print(v...) }
 func (*stdLogger) Println(v ...interface{})               { std.Println(v...) }
 func (*stdLogger) Printf(format string, v ...interface{}) { std.Printf(format, v...) }
+
+type loggerKey struct{}
+
+// withLogger returns db with the output of goose calls on it going to l.
+func withLogger(db *gorm.DB, l Logger) *gorm.DB {
+	return db.WithContext(context.WithValue(db.Statement.Context, loggerKey{}, l))
+}
+
+// logFor returns the logger set on db with withLogger, or the package
+// logger.
+func logFor(db *gorm.DB) Logger {
+	if db != nil && db.Statement != nil && db.Statement.Context != nil {
+		if l, ok := db.Statement.Context.Value(loggerKey{}).(Logger); ok {
+			return l
+		}
+	}
+	return log
+}
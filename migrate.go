@@ -21,20 +21,16 @@ var (
 	MaxVersion int64 = 9223372036854775807 // max(int64)
 
 	registeredGoMigrationsByService = make(map[string]map[int64]*Migration)
+	registrationErrorsByService     = make(map[string][]error)
 )
 
 // Migrations slice.
 type Migrations []*Migration
 
 // helpers so we can use pkg sort
-func (ms Migrations) Len() int      { return len(ms) }
-func (ms Migrations) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
-func (ms Migrations) Less(i, j int) bool {
-	if ms[i].Version == ms[j].Version {
-		panic(fmt.Sprintf("goose: duplicate version %v detected:\n%v\n%v", ms[i].Version, ms[i].Source, ms[j].Source))
-	}
-	return ms[i].Version < ms[j].Version
-}
+func (ms Migrations) Len() int           { return len(ms) }
+func (ms Migrations) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+func (ms Migrations) Less(i, j int) bool { return ms[i].Version < ms[j].Version }
 
 // Current gets the current migration.
 func (ms Migrations) Current(current int64) (*Migration, error) {
@@ -124,27 +120,50 @@ func (ms Migrations) String() string {
 }
 
 // AddMigration adds a migration.
-func AddMigration(service string, up MigrationFn, down MigrationFn) {
+//
+// Registration problems, such as a version conflict, are returned and also
+// reported by CollectMigrations and Validate, since registrations usually
+// happen in init functions that can't handle errors.
+func AddMigration(service string, up MigrationFn, down MigrationFn) error {
+	_, filename, _, _ := runtime.Caller(1)
+	return AddNamedMigration(service, filename, up, down)
+}
+
+// AddMigrationWithOptions adds a migration with metadata.
+func AddMigrationWithOptions(service string, opts MigrationOptions, up MigrationFn, down MigrationFn) error {
 	_, filename, _, _ := runtime.Caller(1)
-	AddNamedMigration(service, filename, up, down)
+	return AddNamedMigrationWithOptions(service, filename, opts, up, down)
 }
 
 // AddNamedMigration : Add a named migration.
-func AddNamedMigration(service string, filename string, up MigrationFn, down MigrationFn) {
+func AddNamedMigration(service string, filename string, up MigrationFn, down MigrationFn) error {
+	return AddNamedMigrationWithOptions(service, filename, MigrationOptions{}, up, down)
+}
+
+// AddNamedMigrationWithOptions : Add a named migration with metadata.
+func AddNamedMigrationWithOptions(service string, filename string, opts MigrationOptions, up MigrationFn, down MigrationFn) error {
 	registeredGoMigrations, ok := registeredGoMigrationsByService[service]
 	if !ok {
 		registeredGoMigrations = make(map[int64]*Migration)
 		registeredGoMigrationsByService[service] = registeredGoMigrations
 	}
 
-	v, _ := NumericComponent(filename)
-	migration := &Migration{Service: service, Version: v, Next: -1, Previous: -1, Registered: true, UpFn: up, DownFn: down, Source: filename}
+	v, err := NumericComponent(filename)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to add migration %q", filename)
+		registrationErrorsByService[service] = append(registrationErrorsByService[service], err)
+		return err
+	}
 
 	if existing, ok := registeredGoMigrations[v]; ok {
-		panic(fmt.Sprintf("failed to add migration %q: version conflicts with %q", filename, existing.Source))
+		err := errors.Errorf("failed to add migration %q: version conflicts with %q", filename, existing.Source)
+		registrationErrorsByService[service] = append(registrationErrorsByService[service], err)
+		return err
 	}
 
+	migration := &Migration{Service: service, Version: v, Next: -1, Previous: -1, Registered: true, UpFn: up, DownFn: down, Source: filename, Options: opts}
 	registeredGoMigrations[v] = migration
+	return nil
 }
 
 // CollectMigrations returns all the valid looking migration scripts in the
@@ -154,12 +173,12 @@ func CollectMigrations(service, dirpath string, current, target int64) (Migratio
 		return nil, fmt.Errorf("%s directory does not exist", dirpath)
 	}
 
-	registeredGoMigrations, ok := registeredGoMigrationsByService[service]
-	if !ok {
-		registeredGoMigrations = make(map[int64]*Migration)
-		registeredGoMigrationsByService[service] = registeredGoMigrations
+	if errs := registrationErrorsByService[service]; len(errs) > 0 {
+		return nil, errs[0]
 	}
 
+	registeredGoMigrations := registeredGoMigrationsByService[service]
+
 	var migrations Migrations
 
 	// SQL migration files.
@@ -185,7 +204,10 @@ func CollectMigrations(service, dirpath string, current, target int64) (Migratio
 			return nil, err
 		}
 		if versionFilter(v, current, target) {
-			migrations = append(migrations, migration)
+			// Copy the registered migration, so linking it below doesn't
+			// mutate the registry shared by concurrent callers.
+			m := *migration
+			migrations = append(migrations, &m)
 		}
 	}
 
@@ -212,6 +234,9 @@ func CollectMigrations(service, dirpath string, current, target int64) (Migratio
 	}
 
 	migrations = sortAndConnectMigrations(migrations)
+	if err := checkDuplicateVersions(migrations); err != nil {
+		return nil, err
+	}
 
 	return migrations, nil
 }
@@ -233,6 +258,17 @@ func sortAndConnectMigrations(migrations Migrations) Migrations {
 	return migrations
 }
 
+// checkDuplicateVersions reports the first version used by more than one
+// migration. The migrations must be sorted.
+func checkDuplicateVersions(migrations Migrations) error {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return errors.Errorf("duplicate version %v detected:\n%v\n%v", migrations[i].Version, migrations[i-1].Source, migrations[i].Source)
+		}
+	}
+	return nil
+}
+
 func versionFilter(v, current, target int64) bool {
 
 	if target > current {
@@ -249,7 +285,11 @@ func versionFilter(v, current, target int64) bool {
 // EnsureDBVersion retrieves the current version for this DB.
 // Create and initialize the DB version table if it doesn't exist.
 func EnsureDBVersion(db *gorm.DB, service string) (int64, error) {
-	rows, err := GetDialect().dbVersionQuery(db, service)
+	if err := upgradeVersionTable(db, service); err != nil {
+		return 0, errors.Wrap(err, "failed to upgrade version table")
+	}
+
+	rows, err := GetDialect().DBVersionQuery(db, service)
 	if err != nil {
 		return 0, createVersionTable(db, service, true)
 	}
@@ -302,7 +342,7 @@ func createRevisionZero(db *gorm.DB, service string, version int, applied bool)
 		return txn.Error
 	}
 	d := GetDialect()
-	if r := txn.Exec(d.insertVersionSQL(service), version, applied); r.Error != nil {
+	if r := txn.Exec(d.InsertVersionSQL(service), version, applied, "", "", ""); r.Error != nil {
 		txn.Rollback()
 		return r.Error
 	}
@@ -312,6 +352,13 @@ func createRevisionZero(db *gorm.DB, service string, version int, applied bool)
 // Create the db version table
 // and insert the initial 0 value into it
 func createVersionTable(db *gorm.DB, service string, createTable bool) error {
+	if err := checkFoldedTableName(db); err != nil {
+		return err
+	}
+	if err := createVersionSchema(db); err != nil {
+		return err
+	}
+
 	txn := db.Begin()
 	if txn.Error != nil {
 		return txn.Error
@@ -319,7 +366,7 @@ func createVersionTable(db *gorm.DB, service string, createTable bool) error {
 
 	d := GetDialect()
 
-	if r := txn.Exec(d.createVersionTableSQL()); r.Error != nil {
+	if r := txn.Exec(d.CreateVersionTableSQL()); r.Error != nil {
 		txn.Rollback()
 		return r.Error
 	}
@@ -328,6 +375,15 @@ func createVersionTable(db *gorm.DB, service string, createTable bool) error {
 	if r.Error != nil {
 		return r.Error
 	}
+
+	// The table has the latest shape, so no upgrade step applies to it.
+	latest := len(versionTableUpgrades(service))
+	if v, tracked := metaVersion(db); !tracked || v < latest {
+		if err := setMetaVersion(db, latest); err != nil {
+			return err
+		}
+	}
+
 	version := 0
 	applied := true
 	err := createRevisionZero(db, service, version, applied)
@@ -1,6 +1,10 @@
 package goose
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -56,3 +60,58 @@ func validateMigrationSort(t *testing.T, ms Migrations, sorted []int64) {
 
 	t.Log(ms)
 }
+
+func TestCollectMigrationsDuplicateVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	for _, name := range []string{"00001_a.sql", "00001_b.sql"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("-- +goose Up\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := CollectMigrations("default", dir, minVersion, maxVersion); err == nil || !strings.Contains(err.Error(), "duplicate version 1") {
+		t.Errorf("expected duplicate version error, got %v", err)
+	}
+}
+
+func TestSQLMigrationErrorLocation(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "00012_add_orders.sql")
+	content := `-- +goose Up
+CREATE TABLE orders (id INTEGER PRIMARY KEY);
+
+INSERT INTO
+  missing_table (id)
+  VALUES (1);
+
+-- +goose Down
+DROP TABLE orders;
+`
+	if err := ioutil.WriteFile(source, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openMemoryDB(t)
+
+	m := &Migration{Service: "test", Version: 12, Source: source}
+	err = m.Up(db)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := `ERROR 00012_add_orders.sql:4: failed to run SQL migration: statement #2 "INSERT INTO missing_table (id) VALUES (1);": failed to execute: `
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("unexpected error, got %q, want prefix %q", err, want)
+	}
+}
@@ -14,14 +14,34 @@ import (
 
 // MigrationRecord struct.
 type MigrationRecord struct {
-	VersionID int64
-	TStamp    time.Time
-	IsApplied bool // was this a result of up() or down()
+	VersionID   int64
+	TStamp      time.Time
+	IsApplied   bool // was this a result of up() or down()
+	Description string
+	Ticket      string
+	Author      string
 }
 
 // MigrationFn used in go migrations.
 type MigrationFn func(tx *gorm.DB) error
 
+// MigrationOptions holds the metadata of a migration. SQL migrations declare
+// it with "-- +goose Key: value" annotations, Go migrations pass it to
+// AddMigrationWithOptions.
+type MigrationOptions struct {
+	Description string
+	Ticket      string
+	Author      string
+	Requires    []Requirement // migrations of other services that must be applied first
+
+	// Background migrations are only queued by up and run in batches by
+	// RunBackground, see AddBackgroundMigration.
+	Background         bool
+	BatchSize          int           // rows per batch of a background migration, 0 for the default
+	Throttle           time.Duration // pause between batches, 0 for the default
+	RequiresBackground []int64       // background migrations of the service that must be done first
+}
+
 // Migration struct.
 type Migration struct {
 	Service    string
@@ -30,8 +50,12 @@ type Migration struct {
 	Previous   int64  // previous version, -1 if none
 	Source     string // path to .sql script or go file
 	Registered bool
-	UpFn       MigrationFn // Up go migration function
-	DownFn     MigrationFn // Down go migration function
+	UpFn       MigrationFn  // Up go migration function
+	DownFn     MigrationFn  // Down go migration function
+	BatchFn    BackgroundFn // batch function of a background go migration
+	Options    MigrationOptions
+
+	optionsLoaded bool
 }
 
 func (m *Migration) String() string {
@@ -40,6 +64,12 @@ func (m *Migration) String() string {
 
 // Up runs an up migration.
 func (m *Migration) Up(db *gorm.DB) error {
+	if err := m.loadOptions(); err != nil {
+		return errors.Wrapf(err, "ERROR %v: failed to parse SQL migration file", filepath.Base(m.Source))
+	}
+	if err := checkRequirements(db, m); err != nil {
+		return err
+	}
 	if err := m.run(db, true); err != nil {
 		return err
 	}
@@ -51,10 +81,47 @@ func (m *Migration) Down(db *gorm.DB) error {
 	if err := m.run(db, false); err != nil {
 		return err
 	}
+	if m.Options.Background {
+		return deleteBackgroundJob(db, m.Service, m.Version)
+	}
 	return nil
 }
 
+// run runs m, retrying it as the retry policy allows.
 func (m *Migration) run(db *gorm.DB, direction bool) error {
+	// Run prepares the session of the whole command; callers of Up, Down
+	// and the like get one per migration.
+	if p, ok := GetDialect().(SessionPreparer); ok && !boundToConn(db) {
+		return withSession(db, p.SessionSQL(), func(db *gorm.DB) error {
+			return m.run(db, direction)
+		})
+	}
+
+	// Versions are recorded with their metadata, so tables created by older
+	// releases need the metadata columns, also when Up or Down is called
+	// without EnsureDBVersion.
+	if err := upgradeVersionTable(db, m.Service); err != nil {
+		return errors.Wrap(err, "failed to upgrade version table")
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := m.runOnce(db, direction)
+		if err == nil || !m.retryable(err, attempt) {
+			return err
+		}
+
+		wait := retryPolicy.backoff(attempt)
+		logFor(db).Printf("goose: %v failed with a transient error, retrying in %v (attempt %d of %d): %v\n",
+			filepath.Base(m.Source), wait, attempt+1, retryPolicy.MaxAttempts, err)
+		select {
+		case <-db.Statement.Context.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (m *Migration) runOnce(db *gorm.DB, direction bool) (err error) {
 	switch filepath.Ext(m.Source) {
 	case ".sql":
 		f, err := os.Open(m.Source)
@@ -63,25 +130,37 @@ func (m *Migration) run(db *gorm.DB, direction bool) error {
 		}
 		defer f.Close()
 
-		statements, useTx, err := parseSQLMigration(f, direction)
-		if err != nil {
+		if err := m.loadOptions(); err != nil {
 			return errors.Wrapf(err, "ERROR %v: failed to parse SQL migration file", filepath.Base(m.Source))
 		}
 
-		if err := runSQLMigration(db, statements, useTx, m.Service, m.Version, direction); err != nil {
-			return errors.Wrapf(err, "ERROR %v: failed to run SQL migration", filepath.Base(m.Source))
+		statements, useTx, err := parseSQLStatements(f, direction)
+		if err != nil {
+			return errors.Wrapf(err, "ERROR %v: failed to parse SQL migration file", m.location(err))
+		}
+
+		if direction && m.Options.Background {
+			return m.enqueue(db)
+		}
+
+		if err := runSQLMigration(db, statements, useTx, m.Service, m.Version, m.Options, direction); err != nil {
+			return errors.Wrapf(err, "ERROR %v: failed to run SQL migration", m.location(err))
 		}
 
 		if len(statements) > 0 {
-			log.Println("OK   ", filepath.Base(m.Source))
+			logFor(db).Println("OK   ", filepath.Base(m.Source))
 		} else {
-			log.Println("EMPTY", filepath.Base(m.Source))
+			logFor(db).Println("EMPTY", filepath.Base(m.Source))
 		}
 
 	case ".go":
 		if !m.Registered {
 			return errors.Errorf("ERROR %v: failed to run Go migration: Go functions must be registered and built into a custom binary (see https://github.com/ottomillrath/goose/tree/master/examples/go-migrations)", m.Source)
 		}
+		if direction && m.Options.Background {
+			return m.enqueue(db)
+		}
+
 		tx := db.Begin()
 		if tx.Error != nil {
 			return errors.Wrap(tx.Error, "ERROR failed to begin transaction")
@@ -100,13 +179,29 @@ func (m *Migration) run(db *gorm.DB, direction bool) error {
 			}
 		}
 
+		if separateVersionTx() {
+			if r := tx.Commit(); r.Error != nil {
+				return errors.Wrap(r.Error, "ERROR failed to commit transaction")
+			}
+			// The changes of fn are committed, so the migration must not
+			// be retried from here on.
+			defer func() {
+				if err != nil {
+					err = &committedError{err}
+				}
+			}()
+			if tx = db.Begin(); tx.Error != nil {
+				return errors.Wrap(tx.Error, "ERROR failed to begin transaction")
+			}
+		}
+
 		if direction {
-			if r := tx.Exec(GetDialect().insertVersionSQL(m.Service), m.Version, direction); r.Error != nil {
+			if r := tx.Exec(GetDialect().InsertVersionSQL(m.Service), m.Version, direction, m.Options.Description, m.Options.Ticket, m.Options.Author); r.Error != nil {
 				tx.Rollback()
 				return errors.Wrap(r.Error, "ERROR failed to execute transaction")
 			}
 		} else {
-			if r := tx.Exec(GetDialect().deleteVersionSQL(m.Service), m.Version); r.Error != nil {
+			if r := tx.Exec(GetDialect().DeleteVersionSQL(m.Service), m.Version); r.Error != nil {
 				tx.Rollback()
 				return errors.Wrap(r.Error, "ERROR failed to execute transaction")
 			}
@@ -117,9 +212,9 @@ func (m *Migration) run(db *gorm.DB, direction bool) error {
 		}
 
 		if fn != nil {
-			log.Println("OK   ", filepath.Base(m.Source))
+			logFor(db).Println("OK   ", filepath.Base(m.Source))
 		} else {
-			log.Println("EMPTY", filepath.Base(m.Source))
+			logFor(db).Println("EMPTY", filepath.Base(m.Source))
 		}
 
 		return nil
@@ -128,6 +223,37 @@ func (m *Migration) run(db *gorm.DB, direction bool) error {
 	return nil
 }
 
+// location returns the file name of m, followed by the line err points to
+// if it is a SQLError.
+func (m *Migration) location(err error) string {
+	if line := sqlLine(err); line > 0 {
+		return fmt.Sprintf("%s:%d", filepath.Base(m.Source), line)
+	}
+	return filepath.Base(m.Source)
+}
+
+// loadOptions reads the metadata annotations of a SQL migration file.
+// Go migrations carry their options from registration.
+func (m *Migration) loadOptions() error {
+	if m.optionsLoaded || filepath.Ext(m.Source) != ".sql" {
+		return nil
+	}
+
+	f, err := os.Open(m.Source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts, err := parseSQLOptions(f)
+	if err != nil {
+		return err
+	}
+	m.Options = opts
+	m.optionsLoaded = true
+	return nil
+}
+
 // NumericComponent looks for migration scripts with names in the form:
 // XXX_descriptivename.ext where XXX specifies the version number
 // and ext specifies the type of migration
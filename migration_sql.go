@@ -1,6 +1,7 @@
 package goose
 
 import (
+	"database/sql"
 	"regexp"
 
 	"github.com/pkg/errors"
@@ -15,7 +16,20 @@ import (
 //
 // All statements following an Up or Down directive are grouped together
 // until another direction directive is found.
-func runSQLMigration(db *gorm.DB, statements []string, useTx bool, service string, v int64, direction bool) error {
+func runSQLMigration(db *gorm.DB, statements []sqlStatement, useTx bool, service string, v int64, opts MigrationOptions, direction bool) (err error) {
+	// A Copier streams COPY data on the connection running the migration.
+	var conn *sql.Conn
+	if _, ok := GetDialect().(Copier); ok && hasCopyBlock(statements) {
+		switch pool := db.Statement.ConnPool.(type) {
+		case *sql.DB:
+			return withSession(db, nil, func(db *gorm.DB) error {
+				return runSQLMigration(db, statements, useTx, service, v, opts, direction)
+			})
+		case *sql.Conn:
+			conn = pool
+		}
+	}
+
 	if useTx {
 		// TRANSACTION.
 
@@ -26,23 +40,42 @@ func runSQLMigration(db *gorm.DB, statements []string, useTx bool, service strin
 			return errors.Wrap(tx.Error, "failed to begin transaction")
 		}
 
-		for _, query := range statements {
-			verboseInfo("Executing statement: %s\n", clearStatement(query))
-			if r := tx.Exec(query); r.Error != nil {
+		for i, stmt := range statements {
+			verboseInfo("Executing statement: %s\n", clearStatement(stmt.SQL))
+			if err := execStatement(tx, conn, stmt.SQL); err != nil {
 				verboseInfo("Rollback transaction")
 				tx.Rollback()
-				return errors.Wrapf(r.Error, "failed to execute SQL query %q", clearStatement(query))
+				return statementError(i, stmt, err)
+			}
+		}
+
+		if separateVersionTx() {
+			verboseInfo("Commit transaction")
+			if r := tx.Commit(); r.Error != nil {
+				return errors.Wrap(r.Error, "failed to commit transaction")
+			}
+			// The statements are committed, so the migration must not be
+			// retried from here on.
+			defer func() {
+				if err != nil {
+					err = &committedError{err}
+				}
+			}()
+
+			verboseInfo("Begin version transaction")
+			if tx = db.Begin(); tx.Error != nil {
+				return errors.Wrap(tx.Error, "failed to begin transaction")
 			}
 		}
 
 		if direction {
-			if r := tx.Exec(GetDialect().insertVersionSQL(service), v, direction); r.Error != nil {
+			if r := tx.Exec(GetDialect().InsertVersionSQL(service), v, direction, opts.Description, opts.Ticket, opts.Author); r.Error != nil {
 				verboseInfo("Rollback transaction")
 				tx.Rollback()
 				return errors.Wrap(r.Error, "failed to insert new goose version")
 			}
 		} else {
-			if r := tx.Exec(GetDialect().deleteVersionSQL(service), v); r.Error != nil {
+			if r := tx.Exec(GetDialect().DeleteVersionSQL(service), v); r.Error != nil {
 				verboseInfo("Rollback transaction")
 				tx.Rollback()
 				return errors.Wrap(r.Error, "failed to delete goose version")
@@ -58,17 +91,63 @@ func runSQLMigration(db *gorm.DB, statements []string, useTx bool, service strin
 	}
 
 	// NO TRANSACTION.
-	for _, query := range statements {
-		verboseInfo("Executing statement: %s", clearStatement(query))
-		if r := db.Exec(query); r.Error != nil {
-			return errors.Wrapf(r.Error, "failed to execute SQL query %q", clearStatement(query))
+	if !direction {
+		for i, stmt := range statements {
+			verboseInfo("Executing statement: %s", clearStatement(stmt.SQL))
+			if err := execStatement(db, conn, stmt.SQL); err != nil {
+				return statementError(i, stmt, err)
+			}
 		}
+		if r := db.Exec(GetDialect().InsertVersionSQL(service), v, direction, opts.Description, opts.Ticket, opts.Author); r.Error != nil {
+			return errors.Wrap(r.Error, "failed to insert new goose version")
+		}
+		return nil
 	}
-	if r := db.Exec(GetDialect().insertVersionSQL(service), v, direction); r.Error != nil {
+
+	// Going up, the migration is dirty until its version is recorded, so a
+	// failure leaves a record of the statements that succeeded.
+	if err := ensureDirtyTable(db); err != nil {
+		return err
+	}
+	start, err := resumeAt(db, service, v)
+	if err != nil {
+		return err
+	}
+	if err := setDirtyState(db, service, v, start, ""); err != nil {
+		return err
+	}
+	for i, stmt := range statements {
+		if i < start {
+			verboseInfo("Skipping statement #%d, it succeeded before", i+1)
+			continue
+		}
+		verboseInfo("Executing statement: %s", clearStatement(stmt.SQL))
+		if err := execStatement(db, conn, stmt.SQL); err != nil {
+			err = statementError(i, stmt, err)
+			if derr := setDirtyState(db, service, v, i, err.Error()); derr != nil {
+				logFor(db).Printf("goose: %v\n", derr)
+			}
+			return err
+		}
+		if err := setDirtyState(db, service, v, i+1, ""); err != nil {
+			return err
+		}
+	}
+	if r := db.Exec(GetDialect().InsertVersionSQL(service), v, direction, opts.Description, opts.Ticket, opts.Author); r.Error != nil {
 		return errors.Wrap(r.Error, "failed to insert new goose version")
 	}
 
-	return nil
+	return ClearDirtyState(db, service)
+}
+
+// statementError is the error of the i-th statement of a migration.
+func statementError(i int, stmt sqlStatement, err error) error {
+	return &SQLError{
+		Line:      stmt.Line,
+		Statement: i + 1,
+		Excerpt:   excerpt(clearStatement(stmt.SQL), 60),
+		Err:       errors.Wrap(err, "failed to execute"),
+	}
 }
 
 const (
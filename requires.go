@@ -0,0 +1,121 @@
+package goose
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Requirement declares that a migration depends on another service
+// sharing the same database having applied at least Version.
+type Requirement struct {
+	Service string
+	Version int64
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s >= %d", r.Service, r.Version)
+}
+
+// parseRequirement parses a requirement of the form "SERVICE >= VERSION".
+func parseRequirement(s string) (Requirement, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 3 || parts[1] != ">=" {
+		return Requirement{}, errors.Errorf("invalid requirement %q: must be of form 'SERVICE >= VERSION'", s)
+	}
+
+	version, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || version < 0 {
+		return Requirement{}, errors.Errorf("invalid requirement %q: version must be a number", s)
+	}
+
+	return Requirement{Service: parts[0], Version: version}, nil
+}
+
+var (
+	waitForRequirements  = false
+	requirementsTimeout  = time.Duration(0)
+	requirementsInterval = 5 * time.Second
+)
+
+// SetWaitForRequirements makes up poll until the requirements of a migration
+// are satisfied instead of failing right away. A zero timeout waits forever.
+func SetWaitForRequirements(wait bool, timeout time.Duration) {
+	waitForRequirements = wait
+	requirementsTimeout = timeout
+}
+
+// checkRequirements makes sure every service the migration requires has been
+// migrated far enough and the background migrations it requires are done,
+// optionally waiting for them to catch up.
+func checkRequirements(db *gorm.DB, m *Migration) error {
+	if len(m.Options.Requires) == 0 && len(m.Options.RequiresBackground) == 0 {
+		return nil
+	}
+
+	var deadline time.Time
+	if requirementsTimeout > 0 {
+		deadline = time.Now().Add(requirementsTimeout)
+	}
+
+	if len(m.Options.Requires) > 0 && !scopesServices() {
+		return errors.Errorf("%v: requirements on other services need a version table with a service column, which the %s dialect doesn't have",
+			filepath.Base(m.Source), dialectName)
+	}
+
+	for {
+		unmet, err := unmetRequirement(db, m)
+		if err != nil || unmet == nil {
+			return err
+		}
+		if !waitForRequirements {
+			return unmet
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return errors.Wrapf(unmet, "gave up waiting after %v", requirementsTimeout)
+		}
+
+		logFor(db).Printf("goose: waiting: %v\n", unmet)
+		time.Sleep(requirementsInterval)
+	}
+}
+
+// unmetRequirement returns the first requirement of m that isn't met, or an
+// error if it can't tell.
+func unmetRequirement(db *gorm.DB, m *Migration) (unmet error, err error) {
+	for _, req := range m.Options.Requires {
+		current, err := appliedVersion(db, req.Service)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get version of service %q", req.Service)
+		}
+
+		if current < req.Version {
+			return errors.Errorf("%v requires service %q at version >= %d, but it is at version %d",
+				filepath.Base(m.Source), req.Service, req.Version, current), nil
+		}
+	}
+
+	return unmetBackgroundRequirement(db, m)
+}
+
+// appliedVersion returns the highest applied version of a service without
+// creating the version table, as EnsureDBVersion would.
+func appliedVersion(db *gorm.DB, service string) (int64, error) {
+	statuses, err := dbMigrationsStatus(db, service)
+	if err != nil {
+		return 0, err
+	}
+
+	current := int64(0)
+	for version, applied := range statuses {
+		if applied && version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
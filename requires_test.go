@@ -0,0 +1,72 @@
+package goose
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckRequirements(t *testing.T) {
+	// Changes the dialect and the wait settings, so not parallel.
+	RegisterDialect("sqlite3-scoped", &scopedSqliteDialect{})
+	if err := SetDialect("sqlite3-scoped"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	defer func(interval time.Duration) { requirementsInterval = interval }(requirementsInterval)
+	requirementsInterval = time.Millisecond
+	defer SetWaitForRequirements(false, 0)
+
+	db := openMemoryDB(t)
+	for _, service := range []string{"billing", "accounts"} {
+		if _, err := EnsureDBVersion(db, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert := GetDialect().InsertVersionSQL("billing")
+	if r := db.Exec(insert, 5, true, "", "", ""); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	m := &Migration{Service: "billing", Version: 6, Source: "00006_invoices.sql"}
+	m.Options.Requires = []Requirement{{Service: "accounts", Version: 3}}
+
+	// The rows of billing don't count for accounts.
+	err := checkRequirements(db, m)
+	if err == nil || !strings.Contains(err.Error(), `requires service "accounts" at version >= 3, but it is at version 0`) {
+		t.Fatalf("expected the requirement to be unmet, got %v", err)
+	}
+
+	SetWaitForRequirements(true, 20*time.Millisecond)
+	if err := checkRequirements(db, m); err == nil || !strings.Contains(err.Error(), "gave up waiting") {
+		t.Fatalf("expected waiting to time out, got %v", err)
+	}
+
+	// Waiting ends once accounts catches up.
+	SetWaitForRequirements(true, 0)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		db.Exec(GetDialect().InsertVersionSQL("accounts"), 3, true, "", "", "")
+	}()
+	if err := checkRequirements(db, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Query errors are returned rather than waited on.
+	for _, statement := range []string{"DROP TABLE goose_db_version", "CREATE TABLE goose_db_version (id INTEGER)"} {
+		if r := db.Exec(statement); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	if err := checkRequirements(db, m); err == nil || !strings.Contains(err.Error(), "failed to get version of service") {
+		t.Fatalf("expected the query error, got %v", err)
+	}
+
+	// Dialects without a service column can't tell services apart.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRequirements(db, m); err == nil || !strings.Contains(err.Error(), "service column") {
+		t.Fatalf("expected the requirement to be rejected, got %v", err)
+	}
+}
@@ -32,9 +32,13 @@ func Reset(db *gorm.DB, service, dir string) error {
 }
 
 func dbMigrationsStatus(db *gorm.DB, service string) (map[int64]bool, error) {
-	rows, err := GetDialect().dbVersionQuery(db, service)
+	rows, err := GetDialect().DBVersionQuery(db, service)
 	if err != nil {
-		return map[int64]bool{}, nil
+		// Without a version table, no migration was applied.
+		if !hasTable(db, QuotedTableName()) {
+			return map[int64]bool{}, nil
+		}
+		return nil, errors.Wrap(err, "failed to query versions")
 	}
 	defer rows.Close()
 
@@ -55,6 +59,9 @@ func dbMigrationsStatus(db *gorm.DB, service string) (map[int64]bool, error) {
 
 		result[row.VersionID] = row.IsApplied
 	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read versions")
+	}
 
 	return result, nil
 }
@@ -0,0 +1,27 @@
+package goose
+
+import (
+	"testing"
+)
+
+func TestResetWithoutVersionTable(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// Nothing was applied, so there is nothing to roll back.
+	db := openMemoryDB(t)
+	if err := Reset(db, "test", "examples/sql-migrations"); err != nil {
+		t.Fatalf("expected reset to do nothing, got %v", err)
+	}
+
+	// A version table that can't be read is an error.
+	if r := db.Exec("CREATE TABLE goose_db_version (id INTEGER)"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if err := Reset(db, "test", "examples/sql-migrations"); err == nil {
+		t.Fatal("expected reset to fail on a broken version table")
+	}
+}
@@ -0,0 +1,121 @@
+package goose
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how migrations that ran in a transaction are retried
+// when they fail with a transient error, like a serialization failure, a
+// deadlock or a lock timeout. The dialect tells transient errors from
+// others, see RetryClassifier. Migrations are retried whole; NO TRANSACTION
+// migrations are never retried.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per migration including the first, retries are off below 2
+	Backoff     time.Duration // pause before the first retry, doubled before each one after
+	MaxBackoff  time.Duration // upper bound of the pause, 0 for none
+}
+
+var retryPolicy = RetryPolicy{}
+
+// SetRetryPolicy sets the retry policy of migrations. Retries are off by
+// default.
+func SetRetryPolicy(p RetryPolicy) {
+	retryPolicy = p
+}
+
+// backoff returns the pause before the retry following attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// committedError is the error of a migration that failed after some of its
+// changes were committed, which makes retrying it unsafe.
+type committedError struct {
+	error
+}
+
+func (e *committedError) Unwrap() error {
+	return e.error
+}
+
+// retryable reports whether m, which failed with err on attempt, may run
+// again.
+func (m *Migration) retryable(err error, attempt int) bool {
+	if attempt >= retryPolicy.MaxAttempts {
+		return false
+	}
+	var committed *committedError
+	if errors.As(err, &committed) {
+		return false
+	}
+	classifier, ok := GetDialect().(RetryClassifier)
+	if !ok || !classifier.IsRetryable(err) {
+		return false
+	}
+	return m.transactional()
+}
+
+// transactional reports whether m runs in a transaction. Go migrations
+// always do, SQL migrations unless they are marked NO TRANSACTION.
+func (m *Migration) transactional() bool {
+	if filepath.Ext(m.Source) != ".sql" {
+		return true
+	}
+	f, err := os.Open(m.Source)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	_, useTx, err := parseSQLStatements(f, true)
+	return err == nil && useTx
+}
+
+// hasSQLState reports whether err comes from a driver error with one of
+// the SQLSTATE codes, like the errors of pgx and lib/pq.
+func hasSQLState(err error, codes ...string) bool {
+	var e interface{ SQLState() string }
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, code := range codes {
+		if e.SQLState() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSQLErrorNumber reports whether err comes from a driver error with one
+// of the error numbers, like the errors of go-mssqldb.
+func hasSQLErrorNumber(err error, numbers ...int32) bool {
+	var e interface{ SQLErrorNumber() int32 }
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, n := range numbers {
+		if e.SQLErrorNumber() == n {
+			return true
+		}
+	}
+	return false
+}
+
+// isSqliteBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED. The
+// sqlite drivers only have their message in common.
+func isSqliteBusy(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked")
+}
@@ -0,0 +1,129 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+type sqlErrorNumber int32
+
+func (e sqlErrorNumber) Error() string         { return "mssql error" }
+func (e sqlErrorNumber) SQLErrorNumber() int32 { return int32(e) }
+
+// deadlockClassifier stands in for the classifier of a MySQL driver.
+type deadlockClassifier struct{}
+
+func (deadlockClassifier) IsRetryable(err error) bool {
+	return strings.Contains(err.Error(), "Deadlock")
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	p := RetryPolicy{MaxAttempts: 6, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	wrap := func(err error) error {
+		return errors.Wrap(statementError(0, sqlStatement{SQL: "UPDATE t SET a = 1;", Line: 2}, err), "failed to run SQL migration")
+	}
+	tt := []struct {
+		dialect RetryClassifier
+		err     error
+		want    bool
+	}{
+		{PostgresDialect{}, wrap(sqlStateError("40001")), true},
+		{PostgresDialect{}, wrap(sqlStateError("40P01")), true},
+		{PostgresDialect{}, wrap(sqlStateError("55P03")), true},
+		{PostgresDialect{}, wrap(sqlStateError("23505")), false},
+		{PostgresDialect{}, wrap(errors.New("connection refused")), false},
+		{CockroachDialect{}, wrap(sqlStateError("40001")), true},
+		{CockroachDialect{}, wrap(sqlStateError("40P01")), false},
+		{SqlServerDialect{}, wrap(sqlErrorNumber(1205)), true},
+		{SqlServerDialect{}, wrap(sqlErrorNumber(2627)), false},
+		{MySQLDialect{}, wrap(errors.New("Deadlock found")), false},
+		{MySQLDialect{Retry: deadlockClassifier{}}, wrap(errors.New("Deadlock found")), true},
+		{MySQLDialect{Retry: deadlockClassifier{}}, wrap(errors.New("Duplicate entry")), false},
+		{TiDBDialect{Retry: deadlockClassifier{}}, wrap(errors.New("Deadlock found")), true},
+		{Sqlite3Dialect{}, wrap(errors.New("database is locked")), true},
+		{Sqlite3Dialect{}, wrap(errors.New("no such table: t")), false},
+	}
+	for _, test := range tt {
+		if got := test.dialect.IsRetryable(test.err); got != test.want {
+			t.Errorf("%T.IsRetryable(%v) = %v, want %v", test.dialect, test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	// Changes the dialect and the retry policy, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	defer SetRetryPolicy(RetryPolicy{})
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openMemoryDB(t)
+
+	attempts := 0
+	up := func(tx *gorm.DB) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("database is locked")
+		}
+		return tx.Exec("CREATE TABLE retried (id INTEGER)").Error
+	}
+	service := "retry"
+	if err := AddNamedMigration(service, "00001_retried.go", up, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(registeredGoMigrationsByService, service)
+
+	if err := Up(db, service, dir); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+
+	// NO TRANSACTION migrations are never retried.
+	source := filepath.Join(dir, "00002_concurrently.sql")
+	content := `-- +goose NO TRANSACTION
+-- +goose Up
+CREATE INDEX retried_id ON retried (id);
+`
+	if err := ioutil.WriteFile(source, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &Migration{Service: service, Version: 2, Source: source}
+	if m.retryable(errors.New("database is locked"), 1) {
+		t.Error("expected a NO TRANSACTION migration not to be retried")
+	}
+}
@@ -0,0 +1,235 @@
+package goose
+
+import "strings"
+
+// sqlSyntax describes the lexical rules of a dialect that matter for
+// finding the end of a statement.
+type sqlSyntax struct {
+	dollarQuotes    bool // $$ ... $$ and $tag$ ... $tag$ strings
+	escapeStrings   bool // E'...' strings with backslash escapes
+	backslashQuotes bool // backslash escapes in all quoted strings
+	backticks       bool // `quoted` identifiers
+	brackets        bool // [quoted] identifiers
+	hashComments    bool // # comments to the end of the line
+	nestedComments  bool // /* /* nested */ block comments */
+	delimiterLines  bool // mysql client DELIMITER commands
+}
+
+// syntaxFor returns the lexical rules of dialect.
+func syntaxFor(dialect string) sqlSyntax {
+	switch dialect {
+	case "postgres", "redshift", "cockroach", "duckdb":
+		return sqlSyntax{dollarQuotes: true, escapeStrings: true, nestedComments: true}
+	case "mysql", "tidb":
+		return sqlSyntax{backslashQuotes: true, backticks: true, hashComments: true, delimiterLines: true}
+	case "clickhouse":
+		return sqlSyntax{backslashQuotes: true, backticks: true}
+	case "sqlite3":
+		return sqlSyntax{backticks: true, brackets: true}
+	case "mssql":
+		return sqlSyntax{brackets: true}
+	default:
+		return sqlSyntax{}
+	}
+}
+
+// Words after BEGIN that make it start a transaction rather than a block.
+var beginTransactionWords = map[string]bool{
+	"TRANSACTION": true,
+	"TRAN":        true,
+	"WORK":        true,
+	"DEFERRED":    true,
+	"IMMEDIATE":   true,
+	"EXCLUSIVE":   true,
+	"DISTRIBUTED": true,
+	"ISOLATION":   true,
+	"READ":        true,
+}
+
+// Words after END that close blocks not opened by BEGIN or CASE.
+var endLoopWords = map[string]bool{
+	"IF":     true,
+	"LOOP":   true,
+	"WHILE":  true,
+	"REPEAT": true,
+	"FOR":    true,
+}
+
+// sqlLexer finds the ends of statements in SQL read line by line. It keeps
+// track of string literals, quoted identifiers and comments, in which
+// delimiters don't count, and of BEGIN ... END and CASE ... END blocks,
+// which may contain delimited statements of their own.
+type sqlLexer struct {
+	syntax sqlSyntax
+
+	quote     byte   // closing character of the open quote, if any
+	escapes   bool   // the open quote has backslash escapes
+	dollarTag string // tag of the open dollar quote
+	inDollar  bool
+	comments  int // depth of open block comments
+
+	blocks    int    // depth of open BEGIN/CASE ... END blocks
+	pending   string // BEGIN or END keyword waiting for the next token
+	statement bool   // a statement has started and not yet ended
+}
+
+func newSQLLexer(dialect string) *sqlLexer {
+	return &sqlLexer{syntax: syntaxFor(dialect)}
+}
+
+// open reports whether a quote or block comment is open at the end of the
+// lines scanned so far.
+func (l *sqlLexer) open() bool {
+	return l.quote != 0 || l.inDollar || l.comments > 0
+}
+
+// inStatement reports whether the lines scanned so far end inside of a
+// statement, that is after a token other than a comment or the delimiter.
+func (l *sqlLexer) inStatement() bool {
+	return l.statement || l.open()
+}
+
+// scan reads the next line and reports whether it ends a statement, that
+// is whether its last token outside of quotes, comments and blocks is
+// delimiter. at is the index of that delimiter in line.
+func (l *sqlLexer) scan(line, delimiter string) (end bool, at int) {
+	at = -1
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case l.comments > 0:
+			if l.syntax.nestedComments && strings.HasPrefix(line[i:], "/*") {
+				l.comments++
+				i += 2
+			} else if strings.HasPrefix(line[i:], "*/") {
+				l.comments--
+				i += 2
+			} else {
+				i++
+			}
+
+		case l.quote != 0:
+			if l.escapes && c == '\\' {
+				i += 2
+			} else if c == l.quote && i+1 < len(line) && line[i+1] == l.quote {
+				i += 2 // doubled quote
+			} else {
+				if c == l.quote {
+					l.quote = 0
+				}
+				i++
+			}
+
+		case l.inDollar:
+			if tag := "$" + l.dollarTag + "$"; strings.HasPrefix(line[i:], tag) {
+				l.inDollar = false
+				i += len(tag)
+			} else {
+				i++
+			}
+
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+
+		case strings.HasPrefix(line[i:], "--"), l.syntax.hashComments && c == '#':
+			// The rest of the line is a comment.
+			return end, at
+
+		case strings.HasPrefix(line[i:], "/*"):
+			l.comments = 1
+			i += 2
+
+		case strings.HasPrefix(line[i:], delimiter):
+			l.token(delimiter, true)
+			end, at = l.blocks == 0, i
+			l.statement = !end
+			i += len(delimiter)
+
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(line) && isIdentPart(line[j]) && !strings.HasPrefix(line[j:], delimiter) {
+				j++
+			}
+			word := strings.ToUpper(line[i:j])
+			if word == "E" && l.syntax.escapeStrings && j < len(line) && line[j] == '\'' {
+				l.token("", false)
+				l.quote, l.escapes = '\'', true
+				j++
+			} else {
+				l.token(word, false)
+			}
+			end, l.statement = false, true
+			i = j
+
+		default:
+			l.token("", false)
+			end, l.statement = false, true
+			i++
+			switch {
+			case c == '\'' || c == '"':
+				l.quote, l.escapes = c, l.syntax.backslashQuotes
+			case c == '`' && l.syntax.backticks:
+				l.quote, l.escapes = '`', false
+			case c == '[' && l.syntax.brackets:
+				l.quote, l.escapes = ']', false
+			case c == '$' && l.syntax.dollarQuotes:
+				j := i
+				for j < len(line) && isIdentPart(line[j]) && line[j] != '$' {
+					j++
+				}
+				if j < len(line) && line[j] == '$' && (j == i || !isDigit(line[i])) {
+					l.dollarTag, l.inDollar = line[i:j], true
+					i = j + 1
+				}
+			}
+		}
+	}
+	return end, at
+}
+
+// token tracks blocks with the next token outside of quotes and comments:
+// an upper-cased keyword, the delimiter, or "" for anything else.
+func (l *sqlLexer) token(word string, delimiter bool) {
+	switch l.pending {
+	case "BEGIN":
+		if !delimiter && !beginTransactionWords[word] {
+			l.blocks++
+		}
+	case "END":
+		if !endLoopWords[word] {
+			l.blocks--
+		}
+		if word == "CASE" {
+			// END CASE closes a CASE statement, rather than opening one.
+			l.pending = ""
+			return
+		}
+	}
+	l.pending = ""
+	if delimiter {
+		return
+	}
+
+	switch word {
+	case "BEGIN":
+		l.pending = word
+	case "CASE":
+		l.blocks++
+	case "END":
+		if l.blocks > 0 {
+			l.pending = word
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
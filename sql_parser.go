@@ -3,10 +3,15 @@ package goose
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/pkg/errors"
 )
@@ -23,8 +28,29 @@ const (
 	gooseStatementEndDown                      // 6
 )
 
+var parserStateNames = map[parserState]string{
+	start:                   "start",
+	gooseUp:                 "Up",
+	gooseStatementBeginUp:   "Up StatementBegin",
+	gooseStatementEndUp:     "Up StatementEnd",
+	gooseDown:               "Down",
+	gooseStatementBeginDown: "Down StatementBegin",
+	gooseStatementEndDown:   "Down StatementEnd",
+}
+
+func (s parserState) String() string {
+	if name, ok := parserStateNames[s]; ok {
+		return name
+	}
+	return "parserState(" + strconv.Itoa(int(s)) + ")"
+}
+
 type stateMachine parserState
 
+func (s stateMachine) String() string {
+	return parserState(s).String()
+}
+
 func (s *stateMachine) Get() parserState {
 	return parserState(*s)
 }
@@ -47,14 +73,138 @@ var bufferPool = sync.Pool{
 // SQL statements for given direction (up=true, down=false).
 //
 // The base case is to simply split on semicolons, as these
-// naturally terminate a statement.
+// naturally terminate a statement. Semicolons in string literals, quoted
+// identifiers, comments, dollar-quoted bodies and BEGIN ... END blocks
+// don't count, see sqlLexer.
 //
-// However, more complex cases like pl/pgsql can have semicolons
-// within a statement. For these cases, we provide the explicit annotations
-// 'StatementBegin' and 'StatementEnd' to allow the script to
+// Statements the lexer can't handle can still be wrapped in the explicit
+// annotations 'StatementBegin' and 'StatementEnd' to allow the script to
 // tell us to ignore semicolons.
 func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool, err error) {
+	statements, useTx, err := parseSQLStatements(r, direction)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, stmt := range statements {
+		stmts = append(stmts, stmt.SQL)
+	}
+	return stmts, useTx, nil
+}
+
+// sqlStatement is a single statement of a SQL migration.
+type sqlStatement struct {
+	SQL        string
+	LintIgnore []string // lint rules suppressed with '-- +goose lint-ignore'
+	Line       int      // first line of the statement in the file
+	EndLine    int      // last line of the statement in the file
+}
+
+// SQLError is an error at a line of a SQL migration, found while parsing it
+// or running one of its statements.
+type SQLError struct {
+	Line      int    // 0 if the error is not tied to a line
+	Statement int    // 1-based index of the failed statement, 0 for parse errors
+	Excerpt   string // start of the failed statement
+	Err       error
+}
+
+func (e *SQLError) Error() string {
+	if e.Statement == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("statement #%d %q: %v", e.Statement, e.Excerpt, e.Err)
+}
+
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
+
+// sqlErrorf returns a parse error at line.
+func sqlErrorf(line int, format string, args ...interface{}) error {
+	return &SQLError{Line: line, Err: errors.Errorf(format, args...)}
+}
+
+// sqlLine returns the line of err if it is a SQLError, and 0 otherwise.
+func sqlLine(err error) int {
+	var se *SQLError
+	if errors.As(err, &se) {
+		return se.Line
+	}
+	return 0
+}
+
+// parseSQLStatements is parseSQLMigration, but returns the statements
+// together with the annotations that apply to them.
+func parseSQLStatements(r io.Reader, direction bool) (stmts []sqlStatement, useTx bool, err error) {
+	return parseSQLStatementsFor(r, direction, dialectName)
+}
+
+// matchBatchSeparator matches the sqlcmd 'GO [count]' batch separator.
+var matchBatchSeparator = regexp.MustCompile(`(?im)^[ \t]*GO(?:[ \t]+(\d+))?[ \t]*$`)
+
+// matchDelimiter matches the mysql client 'DELIMITER token' command.
+var matchDelimiter = regexp.MustCompile(`(?i)^[ \t]*DELIMITER[ \t]+(\S+)[ \t]*$`)
+
+// defaultDelimiter ends statements outside of StatementBegin/StatementEnd.
+const defaultDelimiter = ";"
+
+// parseSQLStatementsFor parses a migration for the given dialect.
+//
+// For mssql, a migration using 'GO' lines is split into the batches between
+// them instead of on semicolons, so procedure bodies can be written without
+// StatementBegin/StatementEnd. 'GO n' runs the batch n times.
+//
+// For mysql and tidb, 'DELIMITER token' lines between statements outside of
+// StatementBegin/StatementEnd blocks change the token ending statements
+// until 'DELIMITER ;', as in mysql dumps. The token is removed from the
+// statements it ends.
+//
+// A 'COPY ... FROM stdin;' line and the data rows after it, up to '\.', make
+// up one statement, as in pg_dump output.
+//
+// Lines after a '-- +goose Dialect name,...' annotation are left out unless
+// dialect is one of the names, up to the next Dialect annotation or the
+// Down section. '-- +goose Dialect *' applies to all dialects again.
+func parseSQLStatementsFor(r io.Reader, direction bool, dialect string) (stmts []sqlStatement, useTx bool, err error) {
 	var buf bytes.Buffer
+	var lintIgnore []string
+	var n, stmtLine, lastLine int // current line and lines of the statement in buf
+	write := func(line string) {
+		if buf.Len() == 0 {
+			stmtLine = n
+		}
+		buf.WriteString(line + "\n")
+		lastLine = n
+	}
+	emit := func() {
+		stmts = append(stmts, sqlStatement{SQL: buf.String(), LintIgnore: lintIgnore, Line: stmtLine, EndLine: lastLine})
+		buf.Reset()
+		lintIgnore = nil
+	}
+
+	var batches bool
+	if dialect == "mssql" {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to read migration")
+		}
+		batches = hasBatchSeparator(data, dialect)
+		r = bytes.NewReader(data)
+	}
+	// emitBatch emits the pending batch, if any, count times.
+	emitBatch := func(count int) {
+		if strings.TrimSpace(buf.String()) == "" {
+			buf.Reset()
+			return
+		}
+		batch := buf.String()
+		buf.Reset()
+		for i := 0; i < count; i++ {
+			buf.WriteString(batch)
+			emit()
+		}
+	}
+
 	scanBuf := bufferPool.Get().([]byte)
 	defer bufferPool.Put(scanBuf)
 
@@ -63,32 +213,103 @@ func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool,
 
 	stateMachine := stateMachine(start)
 	useTx = true
+	delimiter := defaultDelimiter
+	var copyData bool
+	lexer := newSQLLexer(dialect)
+	// Lines of the annotations and commands errors at EOF point to.
+	var upLine, beginLine, delimiterLine, copyLine, openLine int
+	var otherDialect bool // in a Dialect section that excludes dialect
 
 	for scanner.Scan() {
+		n++
 		line := scanner.Text()
 		if verbose {
 			log.Println(line)
 		}
 
-		if strings.HasPrefix(line, "--") {
+		// The data of a COPY ... FROM stdin block is kept as it is, up to
+		// the '\.' line ending it.
+		if copyData {
+			if (stateMachine.Get() == gooseUp) == direction {
+				write(line)
+			}
+			if strings.TrimSpace(line) == copyDataEnd {
+				copyData = false
+				if (stateMachine.Get() == gooseUp) == direction {
+					emit()
+					verboseInfo("StateMachine: store COPY statement")
+				}
+			}
+			continue
+		}
+
+		// Statements outside of StatementBegin/StatementEnd blocks are split
+		// by the lexer. Lines inside their quotes and block comments are
+		// kept as they are, even if empty or looking like annotations.
+		lexed := stateMachine.Get() == gooseUp || stateMachine.Get() == gooseDown
+		simple := !batches && lexed
+		quoted := lexed && lexer.open()
+
+		if !quoted && strings.HasPrefix(line, "--") {
 			cmd := strings.TrimSpace(strings.TrimPrefix(line, "--"))
 
+			if strings.HasPrefix(cmd, "+goose Dialect") {
+				switch stateMachine.Get() {
+				case gooseUp, gooseDown:
+				default:
+					return nil, false, sqlErrorf(n, "'-- +goose Dialect' must be after '-- +goose Up' or '-- +goose Down' and outside of StatementBegin/StatementEnd blocks, state %v", stateMachine)
+				}
+				if strings.TrimSpace(buf.String()) != "" {
+					return nil, false, sqlErrorf(n, "'-- +goose Dialect' inside unfinished SQL query starting at line %d", stmtLine)
+				}
+				names, err := parseDialectAnnotation(strings.TrimPrefix(cmd, "+goose Dialect"))
+				if err != nil {
+					return nil, false, &SQLError{Line: n, Err: err}
+				}
+				otherDialect = !containsString(names, "*") && !containsString(names, dialect)
+				verboseInfo("StateMachine: dialect section %v, skip: %v", names, otherDialect)
+				continue
+			}
+			if otherDialect && cmd != "+goose Up" && cmd != "+goose Down" {
+				continue
+			}
+
+			if strings.HasPrefix(cmd, "+goose lint-ignore") {
+				rules := strings.FieldsFunc(strings.TrimPrefix(cmd, "+goose lint-ignore"), func(r rune) bool {
+					return r == ',' || unicode.IsSpace(r)
+				})
+				lintIgnore = append(lintIgnore, rules...)
+				continue
+			}
+
 			switch cmd {
 			case "+goose Up":
 				switch stateMachine.Get() {
 				case start:
+					upLine = n
 					stateMachine.Set(gooseUp)
 				default:
-					return nil, false, errors.Errorf("duplicate '-- +goose Up' annotations; stateMachine=%v, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine)
+					return nil, false, sqlErrorf(n, "duplicate '-- +goose Up' annotations, the first is at line %d; state %v, see https://github.com/ottomillrath/goose#sql-migrations", upLine, stateMachine)
 				}
 				continue
 
 			case "+goose Down":
 				switch stateMachine.Get() {
 				case gooseUp, gooseStatementEndUp:
+					if batches {
+						// The last batch of Up needs no trailing GO.
+						if direction {
+							emitBatch(1)
+						}
+						buf.Reset()
+					}
+					lexer = newSQLLexer(dialect)
+					otherDialect = false
 					stateMachine.Set(gooseDown)
+				case gooseStatementBeginUp:
+					return nil, false, sqlErrorf(beginLine, "missing '-- +goose StatementEnd' annotation before '-- +goose Down' at line %d", n)
 				default:
-					return nil, false, errors.Errorf("must start with '-- +goose Up' annotation, stateMachine=%v, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine)
+					return nil, false, sqlErrorf(n, "must start with '-- +goose Up' annotation, state %v, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine)
 				}
 				continue
 
@@ -99,8 +320,9 @@ func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool,
 				case gooseDown, gooseStatementEndDown:
 					stateMachine.Set(gooseStatementBeginDown)
 				default:
-					return nil, false, errors.Errorf("'-- +goose StatementBegin' must be defined after '-- +goose Up' or '-- +goose Down' annotation, stateMachine=%v, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine)
+					return nil, false, sqlErrorf(n, "'-- +goose StatementBegin' must be defined after '-- +goose Up' or '-- +goose Down' annotation, state %v, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine)
 				}
+				beginLine = n
 				continue
 
 			case "+goose StatementEnd":
@@ -110,7 +332,7 @@ func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool,
 				case gooseStatementBeginDown:
 					stateMachine.Set(gooseStatementEndDown)
 				default:
-					return nil, false, errors.New("'-- +goose StatementEnd' must be defined after '-- +goose StatementBegin', see https://github.com/ottomillrath/goose#sql-migrations")
+					return nil, false, sqlErrorf(n, "'-- +goose StatementEnd' must be defined after '-- +goose StatementBegin', see https://github.com/ottomillrath/goose#sql-migrations")
 				}
 
 			case "+goose NO TRANSACTION":
@@ -124,15 +346,83 @@ func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool,
 			}
 		}
 
+		if otherDialect {
+			verboseInfo("StateMachine: ignore other dialect")
+			continue
+		}
+
+		if batches {
+			if m := matchBatchSeparator.FindStringSubmatch(line); m != nil && !quoted {
+				count := 1
+				if m[1] != "" {
+					if count, err = strconv.Atoi(m[1]); err != nil {
+						return nil, false, &SQLError{Line: n, Err: errors.Wrapf(err, "invalid batch count %q", m[1])}
+					}
+				}
+				switch stateMachine.Get() {
+				case gooseUp:
+					if direction {
+						emitBatch(count)
+					}
+				case gooseDown:
+					if !direction {
+						emitBatch(count)
+					}
+				default:
+					return nil, false, sqlErrorf(n, "'GO' must be outside of StatementBegin/StatementEnd blocks and after '-- +goose Up', state %v", stateMachine)
+				}
+				buf.Reset()
+				continue
+			}
+			if lexed {
+				// Batches aren't split on semicolons, but GO lines inside
+				// their quotes and comments are no separators either.
+				lexer.scan(line, delimiter)
+				if !quoted && lexer.open() {
+					openLine = n
+				}
+			}
+		}
+
 		// Ignore empty lines.
-		if matchEmptyLines.MatchString(line) {
+		if !quoted && matchEmptyLines.MatchString(line) {
 			verboseInfo("StateMachine: ignore empty line")
 			continue
 		}
 
-		// Write SQL line to a buffer.
-		if _, err := buf.WriteString(line + "\n"); err != nil {
-			return nil, false, errors.Wrap(err, "failed to write to buf")
+		// Simple statements end with the delimiter, which is removed unless
+		// it's the default semicolon.
+		var endOfStatement bool
+		if simple {
+			// A DELIMITER line only counts at the start of a statement, so
+			// it can't be taken for a column named delimiter.
+			if m := matchDelimiter.FindStringSubmatch(line); m != nil && lexer.syntax.delimiterLines && !lexer.inStatement() {
+				verboseInfo("StateMachine: delimiter %q => %q", delimiter, m[1])
+				delimiter, delimiterLine = m[1], n
+				continue
+			}
+			if matchCopyFromStdin.MatchString(line) && !quoted && strings.TrimSpace(buf.String()) == "" {
+				verboseInfo("StateMachine: COPY data begins")
+				copyData, copyLine = true, n
+				if (stateMachine.Get() == gooseUp) == direction {
+					write(line)
+				}
+				continue
+			}
+			var at int
+			endOfStatement, at = lexer.scan(line, delimiter)
+			if !quoted && lexer.open() {
+				openLine = n
+			}
+			if endOfStatement && delimiter != defaultDelimiter {
+				line = strings.TrimRightFunc(line[:at], unicode.IsSpace)
+			}
+		}
+
+		// Write SQL line to a buffer. The StatementEnd annotation is left out:
+		// drivers like sqlite3 return no result for a trailing comment.
+		if stateMachine.Get() != gooseStatementEndUp && stateMachine.Get() != gooseStatementEndDown {
+			write(line)
 		}
 
 		// Read SQL body one by line, if we're in the right direction.
@@ -144,40 +434,38 @@ func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool,
 		case gooseUp, gooseStatementBeginUp, gooseStatementEndUp:
 			if !direction /*down*/ {
 				buf.Reset()
+				lintIgnore = nil
 				verboseInfo("StateMachine: ignore down")
 				continue
 			}
 		case gooseDown, gooseStatementBeginDown, gooseStatementEndDown:
 			if direction /*up*/ {
 				buf.Reset()
+				lintIgnore = nil
 				verboseInfo("StateMachine: ignore up")
 				continue
 			}
 		default:
-			return nil, false, errors.Errorf("failed to parse migration: unexpected state %q on line %q, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine, line)
+			return nil, false, sqlErrorf(n, "failed to parse migration: unexpected state %v on line %q, see https://github.com/ottomillrath/goose#sql-migrations", stateMachine, line)
 		}
 
 		switch stateMachine.Get() {
 		case gooseUp:
-			if endsWithSemicolon(line) {
-				stmts = append(stmts, buf.String())
-				buf.Reset()
+			if endOfStatement {
+				emit()
 				verboseInfo("StateMachine: store simple Up query")
 			}
 		case gooseDown:
-			if endsWithSemicolon(line) {
-				stmts = append(stmts, buf.String())
-				buf.Reset()
+			if endOfStatement {
+				emit()
 				verboseInfo("StateMachine: store simple Down query")
 			}
 		case gooseStatementEndUp:
-			stmts = append(stmts, buf.String())
-			buf.Reset()
+			emit()
 			verboseInfo("StateMachine: store Up statement")
 			stateMachine.Set(gooseUp)
 		case gooseStatementEndDown:
-			stmts = append(stmts, buf.String())
-			buf.Reset()
+			emit()
 			verboseInfo("StateMachine: store Down statement")
 			stateMachine.Set(gooseDown)
 		}
@@ -189,36 +477,164 @@ func parseSQLMigration(r io.Reader, direction bool) (stmts []string, useTx bool,
 
 	switch stateMachine.Get() {
 	case start:
-		return nil, false, errors.New("failed to parse migration: must start with '-- +goose Up' annotation, see https://github.com/ottomillrath/goose#sql-migrations")
+		return nil, false, sqlErrorf(0, "failed to parse migration: must start with '-- +goose Up' annotation, see https://github.com/ottomillrath/goose#sql-migrations")
 	case gooseStatementBeginUp, gooseStatementBeginDown:
-		return nil, false, errors.New("failed to parse migration: missing '-- +goose StatementEnd' annotation")
+		return nil, false, sqlErrorf(beginLine, "failed to parse migration: missing '-- +goose StatementEnd' annotation")
+	}
+	if copyData {
+		return nil, false, sqlErrorf(copyLine, "failed to parse migration: missing %q at the end of COPY data", copyDataEnd)
+	}
+	if lexer.open() {
+		return nil, false, sqlErrorf(openLine, "failed to parse migration: unterminated quoted string, quoted identifier or block comment")
+	}
+	if delimiter != defaultDelimiter {
+		return nil, false, sqlErrorf(delimiterLine, "failed to parse migration: delimiter %q is still active, missing 'DELIMITER ;'", delimiter)
+	}
+
+	if batches {
+		// The last batch needs no trailing GO either.
+		emitBatch(1)
 	}
 
 	if bufferRemaining := strings.TrimSpace(buf.String()); len(bufferRemaining) > 0 {
-		return nil, false, errors.Errorf("failed to parse migration: state %q, direction: %v: unexpected unfinished SQL query: %q: missing semicolon?", stateMachine, direction, bufferRemaining)
+		return nil, false, sqlErrorf(stmtLine, "failed to parse migration: state %v, direction: %v: unexpected unfinished SQL query: %q: missing semicolon?", stateMachine, direction, excerpt(bufferRemaining, 60))
 	}
 
 	return stmts, useTx, nil
 }
 
+// hasBatchSeparator reports whether data has a 'GO' line outside of quotes
+// and block comments.
+func hasBatchSeparator(data []byte, dialect string) bool {
+	lexer := newSQLLexer(dialect)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !lexer.open() && matchBatchSeparator.MatchString(line) {
+			return true
+		}
+		lexer.scan(line, defaultDelimiter)
+	}
+	return false
+}
+
 // Checks the line to see if the line has a statement-ending semicolon
-// or if the line contains a double-dash comment.
+// outside of quotes and comments.
 func endsWithSemicolon(line string) bool {
+	end, _ := newSQLLexer(dialectName).scan(line, defaultDelimiter)
+	return end
+}
+
+// parseDialectAnnotation returns the dialect names of a Dialect annotation,
+// which must be registered or "*".
+func parseDialectAnnotation(list string) ([]string, error) {
+	names := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(names) == 0 {
+		return nil, errors.New("'-- +goose Dialect' needs a comma separated list of dialects, or *")
+	}
+	for _, name := range names {
+		if name == "*" {
+			continue
+		}
+		if _, ok := lookupDialect(name); !ok {
+			return nil, errors.Errorf("'-- +goose Dialect': unknown dialect %q, must be one of: %s", name, strings.Join(Dialects(), ", "))
+		}
+	}
+	return names, nil
+}
+
+// parseSQLOptions extracts the metadata annotations of a SQL migration:
+//
+//	-- +goose Description: Add orders table
+//	-- +goose Ticket: OPS-123
+//	-- +goose Author: Jane Doe
+//	-- +goose Requires: accounts >= 20210401120000
+//	-- +goose RequiresBackground: 20210401130000
+//	-- +goose BACKGROUND
+//	-- +goose Throttle: 500ms
+//	-- +goose BatchSize: 500
+//
+// Repeated Description annotations are joined, so long descriptions can
+// span several lines. Requires and RequiresBackground may be given several
+// times. BACKGROUND makes the migration a background migration, Throttle
+// sets the pause between its batches and BatchSize their size.
+func parseSQLOptions(r io.Reader) (MigrationOptions, error) {
+	var opts MigrationOptions
 	scanBuf := bufferPool.Get().([]byte)
 	defer bufferPool.Put(scanBuf)
 
-	prev := ""
-	scanner := bufio.NewScanner(strings.NewReader(line))
+	scanner := bufio.NewScanner(r)
 	scanner.Buffer(scanBuf, scanBufSize)
-	scanner.Split(bufio.ScanWords)
 
 	for scanner.Scan() {
-		word := scanner.Text()
-		if strings.HasPrefix(word, "--") {
-			break
+		line := scanner.Text()
+		if strings.HasPrefix(line, "--") && strings.TrimSpace(strings.TrimPrefix(line, "--")) == "+goose BACKGROUND" {
+			opts.Background = true
+			continue
+		}
+		key, value, ok := parseOptionAnnotation(line)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Description":
+			if opts.Description != "" {
+				value = opts.Description + " " + value
+			}
+			opts.Description = value
+		case "Ticket":
+			opts.Ticket = value
+		case "Author":
+			opts.Author = value
+		case "Requires":
+			req, err := parseRequirement(value)
+			if err != nil {
+				return MigrationOptions{}, err
+			}
+			opts.Requires = append(opts.Requires, req)
+		case "RequiresBackground":
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || v <= 0 {
+				return MigrationOptions{}, errors.Errorf("invalid background requirement %q: must be a version", value)
+			}
+			opts.RequiresBackground = append(opts.RequiresBackground, v)
+		case "Throttle":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return MigrationOptions{}, errors.Wrapf(err, "invalid throttle %q", value)
+			}
+			opts.Throttle = d
+		case "BatchSize":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return MigrationOptions{}, errors.Errorf("invalid batch size %q: must be a positive number", value)
+			}
+			opts.BatchSize = n
 		}
-		prev = word
 	}
+	if err := scanner.Err(); err != nil {
+		return MigrationOptions{}, errors.Wrap(err, "failed to scan migration")
+	}
+
+	return opts, nil
+}
 
-	return strings.HasSuffix(prev, ";")
+// parseOptionAnnotation splits a "-- +goose Key: value" line.
+func parseOptionAnnotation(line string) (key, value string, ok bool) {
+	if !strings.HasPrefix(line, "--") {
+		return "", "", false
+	}
+	cmd := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+	if !strings.HasPrefix(cmd, "+goose ") {
+		return "", "", false
+	}
+	cmd = strings.TrimSpace(strings.TrimPrefix(cmd, "+goose "))
+
+	idx := strings.Index(cmd, ":")
+	if idx <= 0 || strings.ContainsAny(cmd[:idx], " \t") {
+		return "", "", false
+	}
+	return cmd[:idx], strings.TrimSpace(cmd[idx+1:]), true
 }
@@ -2,6 +2,7 @@ package goose
 
 import (
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -23,6 +24,10 @@ func TestSemicolons(t *testing.T) {
 		{line: "END -- comment", result: false},
 		{line: "END -- comment ;", result: false},
 		{line: "END \" ; \" -- comment", result: false},
+		{line: "SELECT ';'", result: false},
+		{line: "SELECT 1; /* ; */", result: true},
+		{line: "SELECT $$;$$", result: false},
+		{line: "SELECT $1;", result: true},
 	}
 
 	for _, test := range tests {
@@ -50,6 +55,7 @@ func TestSplitStatements(t *testing.T) {
 		{sql: functxt, up: 2, down: 2},
 		{sql: mysqlChangeDelimiter, up: 4, down: 0},
 		{sql: copyFromStdin, up: 1, down: 0},
+		{sql: copyFromStdinUnannotated, up: 2, down: 1},
 		{sql: plpgsqlSyntax, up: 2, down: 2},
 		{sql: plpgsqlSyntaxMixedStatements, up: 2, down: 2},
 	}
@@ -105,6 +111,404 @@ func TestUseTransactions(t *testing.T) {
 	}
 }
 
+func TestParseOptions(t *testing.T) {
+	t.Parallel()
+
+	opts, err := parseSQLOptions(strings.NewReader(optionsSQL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MigrationOptions{
+		Description: "Add orders table with an index on customer",
+		Ticket:      "OPS-123",
+		Author:      "Jane Doe <jane@example.com>",
+		Requires: []Requirement{
+			{Service: "accounts", Version: 20210401120000},
+			{Service: "users", Version: 3},
+		},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("unexpected options, got %+v, want %+v", opts, want)
+	}
+
+	// annotations must not change how the statements are parsed
+	stmts, _, err := parseSQLMigration(strings.NewReader(optionsSQL), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 2 {
+		t.Errorf("incorrect number of up stmts. got %v (%+v), want 2", len(stmts), stmts)
+	}
+}
+
+func TestParseRequirement(t *testing.T) {
+	t.Parallel()
+
+	req, err := parseRequirement(" accounts  >=  20210401120000 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Requirement{Service: "accounts", Version: 20210401120000}); req != want {
+		t.Errorf("unexpected requirement, got %+v, want %+v", req, want)
+	}
+
+	for _, s := range []string{"", "accounts", "accounts > 1", "accounts >= x", "accounts >= 1 2"} {
+		if _, err := parseRequirement(s); err == nil {
+			t.Errorf("expected error on %q", s)
+		}
+	}
+}
+
+func TestBatchSeparators(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		sql     string
+		dialect string
+		up      int
+		down    int
+	}{
+		{sql: mssqlBatches, dialect: "mssql", up: 4, down: 2},
+		{sql: multilineSQL, dialect: "mssql", up: 4, down: 1},    // no GO, split on semicolons
+		{sql: mssqlBatches, dialect: "postgres", up: 2, down: 2}, // GO is no separator, BEGIN ... END is a block
+		{sql: mssqlQuotedGo, dialect: "mssql", up: 3, down: 1},   // GO only in a string and a comment
+		{sql: mssqlBatchComment, dialect: "mssql", up: 2, down: 0},
+	}
+
+	for i, test := range tt {
+		stmts, _, err := parseSQLStatementsFor(strings.NewReader(test.sql), true, test.dialect)
+		if err != nil {
+			t.Error(errors.Wrapf(err, "tt[%v] unexpected error", i))
+		}
+		if len(stmts) != test.up {
+			t.Errorf("tt[%v] incorrect number of up statements. got %v (%q), expected %v", i, len(stmts), stmts, test.up)
+		}
+
+		stmts, _, err = parseSQLStatementsFor(strings.NewReader(test.sql), false, test.dialect)
+		if err != nil {
+			t.Error(errors.Wrapf(err, "tt[%v] unexpected error", i))
+		}
+		if len(stmts) != test.down {
+			t.Errorf("tt[%v] incorrect number of down statements. got %v (%q), expected %v", i, len(stmts), stmts, test.down)
+		}
+	}
+
+	stmts, _, err := parseSQLStatementsFor(strings.NewReader(mssqlBatches), true, "mssql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmts[1].SQL, "SELECT 1;\n    SELECT 2;") {
+		t.Errorf("procedure body was split: %q", stmts[1].SQL)
+	}
+	if stmts[2].SQL != stmts[3].SQL {
+		t.Errorf("'GO 2' did not repeat the batch: %q", stmts[2:])
+	}
+}
+
+func TestLexerSplitting(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name    string
+		dialect string
+		sql     string
+		up      []string
+	}{
+		{
+			name:    "dollar quotes",
+			dialect: "postgres",
+			sql: `-- +goose Up
+CREATE FUNCTION add(a int, b int) RETURNS int AS $$
+BEGIN
+  RETURN a + b;
+END;
+$$ LANGUAGE plpgsql;
+CREATE FUNCTION noop() RETURNS void AS $body$
+BEGIN
+  PERFORM 'it''s $$;';
+END;
+$body$ LANGUAGE plpgsql;
+`,
+			up: []string{
+				"CREATE FUNCTION add(a int, b int) RETURNS int AS $$\nBEGIN\n  RETURN a + b;\nEND;\n$$ LANGUAGE plpgsql;\n",
+				"CREATE FUNCTION noop() RETURNS void AS $body$\nBEGIN\n  PERFORM 'it''s $$;';\nEND;\n$body$ LANGUAGE plpgsql;\n",
+			},
+		},
+		{
+			name:    "strings and comments",
+			dialect: "postgres",
+			sql: `-- +goose Up
+INSERT INTO notes (body) VALUES ('first;
+
+-- not a comment;
+');
+/* a block comment;
+   /* nested; */ still a comment;
+*/
+SELECT E'it\'s;';
+`,
+			up: []string{
+				"INSERT INTO notes (body) VALUES ('first;\n\n-- not a comment;\n');\n",
+				"/* a block comment;\n   /* nested; */ still a comment;\n*/\nSELECT E'it\\'s;';\n",
+			},
+		},
+		{
+			name:    "mysql trigger",
+			dialect: "mysql",
+			sql: `-- +goose Up
+CREATE TRIGGER post_title BEFORE INSERT ON post FOR EACH ROW
+BEGIN
+  IF NEW.title = '' THEN
+    SET NEW.title = 'it\'s untitled;';
+  END IF;
+END; # trigger
+INSERT INTO post (title) VALUES ("a;b");
+`,
+			up: []string{
+				"CREATE TRIGGER post_title BEFORE INSERT ON post FOR EACH ROW\nBEGIN\n  IF NEW.title = '' THEN\n    SET NEW.title = 'it\\'s untitled;';\n  END IF;\nEND; # trigger\n",
+				"INSERT INTO post (title) VALUES (\"a;b\");\n",
+			},
+		},
+		{
+			name:    "mysql case statement",
+			dialect: "mysql",
+			sql: `-- +goose Up
+CREATE PROCEDURE classify(IN n INT)
+BEGIN
+  CASE n
+    WHEN 0 THEN SELECT 'zero';
+    ELSE SELECT 'other';
+  END CASE;
+END;
+INSERT INTO post (title) VALUES ('after');
+`,
+			up: []string{
+				"CREATE PROCEDURE classify(IN n INT)\nBEGIN\n  CASE n\n    WHEN 0 THEN SELECT 'zero';\n    ELSE SELECT 'other';\n  END CASE;\nEND;\n",
+				"INSERT INTO post (title) VALUES ('after');\n",
+			},
+		},
+		{
+			name:    "sqlite trigger and transactions",
+			dialect: "sqlite3",
+			sql: `-- +goose Up
+BEGIN;
+CREATE TRIGGER post_updated AFTER UPDATE ON post
+BEGIN
+  UPDATE post SET kind = CASE WHEN NEW.id > 0 THEN 'new' ELSE 'old' END WHERE id = NEW.id;
+  INSERT INTO [audit;log] VALUES (NEW.id);
+END;
+COMMIT;
+`,
+			up: []string{
+				"BEGIN;\n",
+				"CREATE TRIGGER post_updated AFTER UPDATE ON post\nBEGIN\n  UPDATE post SET kind = CASE WHEN NEW.id > 0 THEN 'new' ELSE 'old' END WHERE id = NEW.id;\n  INSERT INTO [audit;log] VALUES (NEW.id);\nEND;\n",
+				"COMMIT;\n",
+			},
+		},
+	}
+
+	for _, test := range tt {
+		statements, _, err := parseSQLStatementsFor(strings.NewReader(test.sql), true, test.dialect)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, stmt := range statements {
+			got = append(got, stmt.SQL)
+		}
+		if !reflect.DeepEqual(got, test.up) {
+			t.Errorf("%s: incorrect statements.\ngot  %q\nwant %q", test.name, got, test.up)
+		}
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		sql     string
+		dialect string
+		up      []string
+		down    []string
+	}{
+		{
+			sql:     mysqlDelimiterDump,
+			dialect: "mysql",
+			up: []string{
+				"CREATE PROCEDURE list_posts()\nBEGIN\n  SELECT id FROM post;\n  SELECT title FROM post;\nEND\n",
+				"CREATE TRIGGER post_title BEFORE INSERT ON post FOR EACH ROW\nBEGIN\n  SET NEW.title = TRIM(NEW.title);\nEND\n",
+				"INSERT INTO post (id, title) VALUES (1, 'hello');\n",
+			},
+			down: []string{
+				"DROP TRIGGER post_title\n",
+				"DROP PROCEDURE list_posts;\n",
+			},
+		},
+		{
+			sql:     delimiterColumn,
+			dialect: "mysql",
+			up:      []string{"CREATE TABLE post (\n  id INT,\n  delimiter VARCHAR(8)\n);\n"},
+		},
+		{
+			sql:     delimiterColumn,
+			dialect: "postgres",
+			up:      []string{"CREATE TABLE post (\n  id INT,\n  delimiter VARCHAR(8)\n);\n"},
+		},
+		{
+			sql:     postgresDelimiterLine,
+			dialect: "postgres",
+			up:      []string{"ALTER TABLE post\n  delimiter text;\n"},
+		},
+	}
+
+	for i, test := range tt {
+		for _, direction := range []bool{true, false} {
+			want := test.up
+			if !direction {
+				want = test.down
+			}
+			statements, _, err := parseSQLStatementsFor(strings.NewReader(test.sql), direction, test.dialect)
+			if err != nil {
+				t.Fatal(errors.Wrapf(err, "tt[%v] unexpected error", i))
+			}
+			var stmts []string
+			for _, stmt := range statements {
+				stmts = append(stmts, stmt.SQL)
+			}
+			if !reflect.DeepEqual(stmts, want) {
+				t.Errorf("tt[%v] incorrect statements, direction %v. got %q, want %q", i, direction, stmts, want)
+			}
+		}
+	}
+}
+
+func TestStatementLines(t *testing.T) {
+	t.Parallel()
+
+	stmts, _, err := parseSQLStatements(strings.NewReader(multilineSQL), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]int
+	for _, stmt := range stmts {
+		got = append(got, [2]int{stmt.Line, stmt.EndLine})
+	}
+	want := [][2]int{{2, 7}, {10, 10}, {11, 11}, {12, 12}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected statement lines, got %v, want %v", got, want)
+	}
+
+	stmts, _, err = parseSQLStatements(strings.NewReader(functxt), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmts[1].Line != 9 || stmts[1].EndLine != 28 {
+		t.Errorf("unexpected lines of StatementBegin block, got %d-%d, want 9-28", stmts[1].Line, stmts[1].EndLine)
+	}
+}
+
+func TestStatementEndLeftOut(t *testing.T) {
+	t.Parallel()
+
+	// Drivers like sqlite3 return no result for a trailing comment, so the
+	// StatementEnd annotation must not end up in the statement.
+	for _, direction := range []bool{true, false} {
+		stmts, _, err := parseSQLStatements(strings.NewReader(plpgsqlSyntax), direction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, stmt := range stmts {
+			if strings.Contains(stmt.SQL, "StatementEnd") {
+				t.Errorf("unexpected StatementEnd annotation in %q", stmt.SQL)
+			}
+		}
+	}
+}
+
+func TestParsingErrorLines(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		sql     string
+		dialect string
+		line    int
+		msg     string
+	}{
+		{sql: statementBeginNoStatementEnd, dialect: "postgres", line: 8, msg: "missing '-- +goose StatementEnd' annotation"},
+		{sql: multiUpDown, dialect: "postgres", line: 12, msg: "duplicate '-- +goose Up' annotations, the first is at line 1; state Down"},
+		{sql: delimiterNotRestored, dialect: "mysql", line: 2, msg: `delimiter "$$" is still active`},
+		{sql: unterminatedString, dialect: "postgres", line: 2, msg: "unterminated quoted string"},
+		{sql: unfinishedSQL, dialect: "postgres", line: 3, msg: "unexpected unfinished SQL query"},
+	}
+	for i, test := range tt {
+		_, _, err := parseSQLStatementsFor(strings.NewReader(test.sql), true, test.dialect)
+		if err == nil {
+			t.Errorf("tt[%v] expected an error", i)
+			continue
+		}
+		if line := sqlLine(err); line != test.line {
+			t.Errorf("tt[%v] unexpected line of %q, got %d, want %d", i, err, line, test.line)
+		}
+		if !strings.Contains(err.Error(), test.msg) {
+			t.Errorf("tt[%v] unexpected error, got %q, want %q", i, err, test.msg)
+		}
+	}
+}
+
+func TestDialectSections(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		dialect string
+		up      []string
+		down    []string
+	}{
+		{
+			dialect: "postgres",
+			up: []string{
+				"CREATE TABLE post (id SERIAL PRIMARY KEY, deleted_at timestamp);\n",
+				"CREATE INDEX post_live ON post (id) WHERE deleted_at IS NULL;\n",
+				"INSERT INTO post DEFAULT VALUES;\n",
+			},
+			down: []string{"DROP TABLE post;\n"},
+		},
+		{
+			dialect: "sqlite3",
+			up: []string{
+				"CREATE TABLE post (id INTEGER PRIMARY KEY AUTOINCREMENT, deleted_at timestamp);\n",
+				"INSERT INTO post DEFAULT VALUES;\n",
+			},
+			down: []string{"DROP INDEX IF EXISTS post_live;\n", "DROP TABLE post;\n"},
+		},
+		{
+			dialect: "mysql",
+			up:      []string{"INSERT INTO post DEFAULT VALUES;\n"},
+			down:    []string{"DROP INDEX IF EXISTS post_live;\n", "DROP TABLE post;\n"},
+		},
+	}
+
+	for _, test := range tt {
+		for _, direction := range []bool{true, false} {
+			want := test.up
+			if !direction {
+				want = test.down
+			}
+			stmts, _, err := parseSQLStatementsFor(strings.NewReader(dialectSections), direction, test.dialect)
+			if err != nil {
+				t.Fatalf("%s: %v", test.dialect, err)
+			}
+			var got []string
+			for _, stmt := range stmts {
+				got = append(got, stmt.SQL)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: incorrect statements, direction %v.\ngot  %q\nwant %q", test.dialect, direction, got, want)
+			}
+		}
+	}
+}
+
 func TestParsingErrors(t *testing.T) {
 	tt := []string{
 		statementBeginNoStatementEnd,
@@ -112,6 +516,11 @@ func TestParsingErrors(t *testing.T) {
 		noUpDownAnnotations,
 		multiUpDown,
 		downFirst,
+		copyWithoutEnd,
+		unterminatedString,
+		dialectBeforeUp,
+		dialectUnknown,
+		dialectInsideStatement,
 	}
 	for i, sql := range tt {
 		_, _, err := parseSQLMigration(strings.NewReader(sql), true)
@@ -174,6 +583,21 @@ drop function histories_partition_creation(DATE, DATE);
 drop TABLE histories;
 `
 
+var optionsSQL = `-- +goose Description: Add orders table
+-- +goose Description: with an index on customer
+-- +goose Ticket: OPS-123
+-- +goose Author: Jane Doe <jane@example.com>
+-- +goose Requires: accounts >= 20210401120000
+-- +goose Requires: users >= 3
+-- Note: plain comments are not metadata.
+-- +goose Up
+CREATE TABLE orders (id int, customer_id int);
+CREATE INDEX orders_customer ON orders (customer_id);
+
+-- +goose Down
+DROP TABLE orders;
+`
+
 var multiUpDown = `-- +goose Up
 CREATE TABLE post (
 		id int NOT NULL,
@@ -342,3 +766,154 @@ FOR EACH ROW EXECUTE PROCEDURE  update_updated_at_column();
 DROP TRIGGER update_properties_updated_at;
 DROP FUNCTION update_updated_at_column();
 `
+
+var mssqlBatches = `-- +goose Up
+CREATE TABLE dbo.post (id INT NOT NULL);
+GO
+
+CREATE PROCEDURE dbo.get_posts AS
+BEGIN
+    SELECT 1;
+    SELECT 2;
+END
+go
+INSERT INTO dbo.post (id) VALUES (1);
+GO 2
+
+-- +goose Down
+DROP PROCEDURE dbo.get_posts;
+GO
+DROP TABLE dbo.post;
+`
+
+var mssqlQuotedGo = `-- +goose Up
+INSERT INTO dbo.note (body) VALUES ('first line
+GO
+last line');
+/*
+GO
+*/
+INSERT INTO dbo.note (body) VALUES ('second');
+INSERT INTO dbo.note (body) VALUES ('third');
+
+-- +goose Down
+DELETE FROM dbo.note;
+`
+
+var mssqlBatchComment = `-- +goose Up
+CREATE PROCEDURE dbo.noop AS
+BEGIN
+    /*
+    GO
+    */
+    SELECT 1;
+END
+GO
+INSERT INTO dbo.note (body) VALUES ('GO');
+`
+
+var mysqlDelimiterDump = `-- +goose Up
+DELIMITER $$
+CREATE PROCEDURE list_posts()
+BEGIN
+  SELECT id FROM post;
+  SELECT title FROM post;
+END$$
+
+CREATE TRIGGER post_title BEFORE INSERT ON post FOR EACH ROW
+BEGIN
+  SET NEW.title = TRIM(NEW.title);
+END $$ -- trim titles
+DELIMITER ;
+
+INSERT INTO post (id, title) VALUES (1, 'hello');
+
+-- +goose Down
+delimiter //
+DROP TRIGGER post_title //
+delimiter ;
+DROP PROCEDURE list_posts;
+`
+
+var delimiterNotRestored = `-- +goose Up
+DELIMITER $$
+CREATE PROCEDURE noop()
+BEGIN
+END$$
+
+-- +goose Down
+DROP PROCEDURE noop$$
+`
+
+var delimiterColumn = `-- +goose Up
+CREATE TABLE post (
+  id INT,
+  delimiter VARCHAR(8)
+);
+`
+
+var postgresDelimiterLine = `-- +goose Up
+ALTER TABLE post
+  delimiter text;
+`
+
+var copyFromStdinUnannotated = `-- +goose Up
+CREATE TABLE django_content_type (id int PRIMARY KEY, app_label text NOT NULL, model text);
+
+COPY django_content_type (id, app_label, model) FROM stdin;
+1	admin	logentry
+2	auth	permission
+3	contrib	\N
+4	tab\there	-- not a comment
+\.
+
+-- +goose Down
+DROP TABLE django_content_type;
+`
+
+var copyWithoutEnd = `-- +goose Up
+COPY django_content_type (id, app_label, model) FROM stdin;
+1	admin	logentry
+
+-- +goose Down
+DROP TABLE django_content_type;
+`
+
+var unterminatedString = `-- +goose Up
+INSERT INTO post (title) VALUES ('untitled);
+
+-- +goose Down
+DELETE FROM post;
+`
+
+var dialectSections = `-- +goose Up
+-- +goose Dialect postgres,redshift
+CREATE TABLE post (id SERIAL PRIMARY KEY, deleted_at timestamp);
+CREATE INDEX post_live ON post (id) WHERE deleted_at IS NULL;
+-- +goose Dialect sqlite3
+CREATE TABLE post (id INTEGER PRIMARY KEY AUTOINCREMENT, deleted_at timestamp);
+-- +goose Dialect *
+INSERT INTO post DEFAULT VALUES;
+
+-- +goose Down
+-- +goose Dialect sqlite3, mysql
+DROP INDEX IF EXISTS post_live;
+-- +goose Dialect *
+DROP TABLE post;
+`
+
+var dialectBeforeUp = `-- +goose Dialect sqlite3
+-- +goose Up
+SELECT 1;
+`
+
+var dialectUnknown = `-- +goose Up
+-- +goose Dialect postgress
+SELECT 1;
+`
+
+var dialectInsideStatement = `-- +goose Up
+SELECT
+-- +goose Dialect sqlite3
+1;
+`
@@ -0,0 +1,127 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The tests run against in-memory SQLite databases. The dialects below
+// wrap Sqlite3Dialect with the optional behaviours of other dialects.
+
+// openMemoryDB opens an in-memory SQLite database, closed with the test.
+func openMemoryDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // keep the in-memory database
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// scopedSqliteDialect is a SQLite dialect whose version table records the
+// service of versions, like the Postgres one.
+type scopedSqliteDialect struct {
+	Sqlite3Dialect
+}
+
+func (m scopedSqliteDialect) CreateVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		service TEXT NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now')),
+		description TEXT,
+		ticket TEXT,
+		author TEXT
+	)`, stdTableName())
+}
+
+func (m scopedSqliteDialect) InsertVersionSQL(service string) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied, service, description, ticket, author) VALUES (?, ?, '%s', ?, ?, ?)", stdTableName(), service)
+}
+
+func (m scopedSqliteDialect) DBVersionQuery(db *gorm.DB, service string) (*sql.Rows, error) {
+	return db.Raw(fmt.Sprintf("SELECT version_id, is_applied FROM %s WHERE service = '%s' ORDER BY id DESC", stdTableName(), service)).Rows()
+}
+
+func (m scopedSqliteDialect) MigrationSQL(service string) string {
+	return fmt.Sprintf("SELECT tstamp, is_applied, description FROM %s WHERE version_id = ? AND service = '%s' ORDER BY id DESC LIMIT 1", stdTableName(), service)
+}
+
+func (m scopedSqliteDialect) DeleteVersionSQL(service string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id = ? AND service = '%s'", stdTableName(), service)
+}
+
+func (m scopedSqliteDialect) ScopesServices() bool {
+	return true
+}
+
+// VersionTableUpgrades adds the service column last, like the SQL Server
+// dialect.
+func (m scopedSqliteDialect) VersionTableUpgrades(service string) []VersionTableUpgrade {
+	return append(m.Sqlite3Dialect.VersionTableUpgrades(service), addColumnUpgrades("ALTER TABLE %s ADD COLUMN %s", stdTableName(),
+		fmt.Sprintf("service TEXT NOT NULL DEFAULT '%s'", service))...)
+}
+
+// sessionSqliteDialect enables foreign keys on the connection of migrations.
+type sessionSqliteDialect struct {
+	Sqlite3Dialect
+}
+
+func (m sessionSqliteDialect) SessionSQL() []string {
+	return []string{"PRAGMA foreign_keys = ON"}
+}
+
+// lockingSqliteDialect records when upgrade steps lock and unlock, in the
+// upgrade_locks table.
+type lockingSqliteDialect struct {
+	Sqlite3Dialect
+}
+
+func (m lockingSqliteDialect) UpgradeLockSQL(key string) (lock, unlock string) {
+	return "INSERT INTO upgrade_locks (event) VALUES ('lock " + key + "')", "INSERT INTO upgrade_locks (event) VALUES ('unlock')"
+}
+
+// tenantSqliteDialect keeps the tables of every tenant in a shared in-memory
+// database, attached as the tenant schema by SearchPathSQL. Unqualified
+// names are looked up there once the main database doesn't have them.
+type tenantSqliteDialect struct {
+	Sqlite3Dialect
+}
+
+func (m tenantSqliteDialect) SearchPathSQL(schema string) (set, reset string) {
+	return fmt.Sprintf("ATTACH DATABASE '%s' AS tenant", tenantDatabase(schema)), "DETACH DATABASE tenant"
+}
+
+func (m tenantSqliteDialect) CreateVersionTableSQL() string {
+	return strings.Replace(m.Sqlite3Dialect.CreateVersionTableSQL(), "CREATE TABLE ", "CREATE TABLE tenant.", 1)
+}
+
+func (m tenantSqliteDialect) CreateDirtyTableSQL(table string) string {
+	return ""
+}
+
+func (m tenantSqliteDialect) CreateMetaTableSQL(table string) string {
+	return fmt.Sprintf("CREATE TABLE tenant.%s (meta_version INTEGER NOT NULL PRIMARY KEY)", table)
+}
+
+func (m tenantSqliteDialect) CreateBackgroundTableSQL(table string) string {
+	return ""
+}
+
+// tenantDatabase returns the URI of the in-memory database of schema.
+func tenantDatabase(schema string) string {
+	return "file:tenant_" + schema + "?mode=memory&cache=shared"
+}
@@ -2,6 +2,7 @@ package goose
 
 import (
 	"database/sql"
+	"fmt"
 	"path/filepath"
 	"time"
 
@@ -22,39 +23,62 @@ func Status(db *gorm.DB, service, dir string) error {
 		return errors.Wrap(err, "failed to ensure DB version")
 	}
 
-	log.Println("    Applied At                  Migration")
-	log.Println("    =======================================")
+	dirty, err := GetDirtyState(db, service)
+	if err != nil {
+		return err
+	}
+
+	logFor(db).Println("    Applied At                  Migration")
+	logFor(db).Println("    =======================================")
 	for _, migration := range migrations {
-		if err := printMigrationStatus(db, migration.Version, filepath.Base(migration.Source), service); err != nil {
+		if err := printMigrationStatus(db, migration, service, dirty); err != nil {
 			return errors.Wrap(err, "failed to print status")
 		}
 	}
 
+	if dirty != nil {
+		logFor(db).Printf("goose: %s\n", dirty)
+	}
 	return nil
 }
 
-func printMigrationStatus(db *gorm.DB, version int64, script string, service string) error {
-	q := GetDialect().migrationSQL(service)
+func printMigrationStatus(db *gorm.DB, migration *Migration, service string, dirty *DirtyState) error {
+	q := GetDialect().MigrationSQL(service)
 
 	var row MigrationRecord
+	var description sql.NullString
 
-	internalDb, err := db.DB()
-	if err != nil {
-		return err
-	}
-
-	err = internalDb.QueryRow(q, version).Scan(&row.TStamp, &row.IsApplied)
+	// Query through the statement's connection rather than db.DB(), so
+	// sessions bound to a single connection (see RunTenants) are honored.
+	err := db.Statement.ConnPool.QueryRowContext(db.Statement.Context, q, migration.Version).Scan(&row.TStamp, &row.IsApplied, &description)
 	if err != nil && err != sql.ErrNoRows {
 		return errors.Wrap(err, "failed to query the latest migration")
 	}
+	row.Description = description.String
+
+	// Pending migrations have no stored description yet, so show
+	// the one declared in the migration itself.
+	if row.Description == "" {
+		if err := migration.loadOptions(); err != nil {
+			return errors.Wrapf(err, "failed to parse %s", filepath.Base(migration.Source))
+		}
+		row.Description = migration.Options.Description
+	}
 
 	var appliedAt string
 	if row.IsApplied {
 		appliedAt = row.TStamp.Format(time.ANSIC)
+	} else if dirty != nil && dirty.Version == migration.Version {
+		appliedAt = fmt.Sprintf("Dirty (%d statements)", dirty.Applied)
 	} else {
 		appliedAt = "Pending"
 	}
 
-	log.Printf("    %-24s -- %v\n", appliedAt, script)
+	script := filepath.Base(migration.Source)
+	if row.Description != "" {
+		logFor(db).Printf("    %-24s -- %v -- %v\n", appliedAt, script, row.Description)
+	} else {
+		logFor(db).Printf("    %-24s -- %v\n", appliedAt, script)
+	}
 	return nil
 }
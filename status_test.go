@@ -0,0 +1,142 @@
+package goose
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bufferLogger records the output of goose, for tests of what it prints.
+type bufferLogger struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (l *bufferLogger) Fatal(v ...interface{})                 { panic(fmt.Sprint(v...)) }
+func (l *bufferLogger) Fatalf(format string, v ...interface{}) { panic(fmt.Sprintf(format, v...)) }
+func (l *bufferLogger) Print(v ...interface{})                 { l.write(fmt.Sprint(v...)) }
+func (l *bufferLogger) Println(v ...interface{})               { l.write(fmt.Sprintln(v...)) }
+func (l *bufferLogger) Printf(format string, v ...interface{}) { l.write(fmt.Sprintf(format, v...)) }
+
+func (l *bufferLogger) write(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.WriteString(s)
+}
+
+func (l *bufferLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func TestMigrationMetadata(t *testing.T) {
+	// Changes the dialect and the logger, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	out := &bufferLogger{}
+	SetLogger(out)
+	defer SetLogger(&stdLogger{})
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_orders.sql": `-- +goose Description: Add orders table
+-- +goose Ticket: OPS-123
+-- +goose Author: Jane Doe
+-- +goose Up
+CREATE TABLE orders (id INTEGER PRIMARY KEY);
+
+-- +goose Down
+DROP TABLE orders;
+`,
+		"00002_invoices.sql": `-- +goose Description: Add invoices table
+-- +goose Up
+CREATE TABLE invoices (id INTEGER PRIMARY KEY);
+
+-- +goose Down
+DROP TABLE invoices;
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := openMemoryDB(t)
+	if err := UpTo(db, "test", dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var description, ticket, author string
+	q := "SELECT description, ticket, author FROM goose_db_version WHERE version_id = 1"
+	if err := db.Raw(q).Row().Scan(&description, &ticket, &author); err != nil {
+		t.Fatal(err)
+	}
+	if description != "Add orders table" || ticket != "OPS-123" || author != "Jane Doe" {
+		t.Errorf("unexpected metadata %q, %q, %q", description, ticket, author)
+	}
+
+	if err := Status(db, "test", dir); err != nil {
+		t.Fatal(err)
+	}
+	// The applied migration shows its stored description, the pending one
+	// the description of its file.
+	for _, want := range []string{"-- 00001_orders.sql -- Add orders table", "Pending                  -- 00002_invoices.sql -- Add invoices table"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected status to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestMigrationMetadataOldTable(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "00001_orders.sql")
+	content := "-- +goose Description: Add orders table\n-- +goose Up\nCREATE TABLE orders (id INTEGER PRIMARY KEY);\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A version table of a release before the metadata columns.
+	db := openMemoryDB(t)
+	q := `CREATE TABLE goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`
+	if r := db.Exec(q); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	// Running the migration directly records it with its metadata.
+	m := &Migration{Service: "test", Version: 1, Source: path}
+	if err := m.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	var description string
+	if err := db.Raw("SELECT description FROM goose_db_version WHERE version_id = 1").Row().Scan(&description); err != nil || description != "Add orders table" {
+		t.Errorf("unexpected description %q, %v", description, err)
+	}
+}
@@ -0,0 +1,235 @@
+package goose
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// TenantSource lists the Postgres schemas to migrate in multi-tenant mode.
+type TenantSource func(db *gorm.DB) ([]string, error)
+
+// TenantsFromFile reads one schema name per line from path. Empty lines
+// and lines starting with '#' are ignored.
+func TenantsFromFile(path string) TenantSource {
+	return func(db *gorm.DB) ([]string, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open tenants file")
+		}
+		defer f.Close()
+
+		var schemas []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			schemas = append(schemas, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "failed to read tenants file")
+		}
+		return schemas, nil
+	}
+}
+
+// TenantsFromQuery runs query and uses the first column of every row as a
+// schema name, e.g. "SELECT schema_name FROM customers WHERE active".
+func TenantsFromQuery(query string) TenantSource {
+	return func(db *gorm.DB) ([]string, error) {
+		rows, err := db.Raw(query).Rows()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to query tenants")
+		}
+		defer rows.Close()
+
+		var schemas []string
+		for rows.Next() {
+			var schema string
+			if err := rows.Scan(&schema); err != nil {
+				return nil, errors.Wrap(err, "failed to scan tenant")
+			}
+			schemas = append(schemas, schema)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, errors.Wrap(err, "failed to get next tenant")
+		}
+		return schemas, nil
+	}
+}
+
+// TenantOptions configures RunTenants.
+type TenantOptions struct {
+	Tenants         TenantSource
+	Workers         int  // number of schemas migrated concurrently, defaults to 1
+	ContinueOnError bool // keep migrating the remaining schemas after a failure
+}
+
+// TenantResult is the outcome of a command for a single schema.
+type TenantResult struct {
+	Schema  string
+	Version int64
+	Err     error
+	Skipped bool // not run because an earlier tenant failed
+}
+
+// TenantReport holds the results of RunTenants, ordered by schema.
+type TenantReport []TenantResult
+
+// Failed returns the number of tenants that failed or were skipped.
+func (r TenantReport) Failed() int {
+	n := 0
+	for _, res := range r {
+		if res.Err != nil || res.Skipped {
+			n++
+		}
+	}
+	return n
+}
+
+// Print logs a per-tenant summary to the logger of db.
+func (r TenantReport) Print(db *gorm.DB) {
+	logFor(db).Println("    Schema                       Version          Result")
+	logFor(db).Println("    =======================================================")
+	for _, res := range r {
+		switch {
+		case res.Skipped:
+			logFor(db).Printf("    %-28s %-16s skipped\n", res.Schema, "-")
+		case res.Err != nil:
+			logFor(db).Printf("    %-28s %-16d FAILED: %v\n", res.Schema, res.Version, res.Err)
+		default:
+			logFor(db).Printf("    %-28s %-16d OK\n", res.Schema, res.Version)
+		}
+	}
+	logFor(db).Printf("    %d tenants, %d failed\n", len(r), r.Failed())
+}
+
+// RunTenants runs a goose command against every Postgres schema listed by
+// opts.Tenants. Each schema is migrated on its own connection with
+// search_path set to that schema only, so it keeps its own version table.
+// The dialect must be a SearchPathSetter.
+//
+// Unless opts.ContinueOnError is set, no new schemas are started after the
+// first failure. The returned error is non-nil if any tenant failed.
+func RunTenants(command string, db *gorm.DB, service, dir string, opts TenantOptions, args ...string) (TenantReport, error) {
+	searchPath, ok := GetDialect().(SearchPathSetter)
+	if !ok {
+		return nil, errors.Errorf("multi-tenant mode needs a search path, which the %s dialect doesn't have", dialectName)
+	}
+	// Every schema keeps its own version table, found on the search_path.
+	if tableSchema != "" {
+		return nil, errors.Errorf("multi-tenant mode keeps a version table in every schema, so it can't be in schema %s", tableSchema)
+	}
+	if opts.Tenants == nil {
+		return nil, errors.New("no tenant source given")
+	}
+
+	schemas, err := opts.Tenants(db)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(schemas)
+
+	// Validate the migrations once up front, rather than once per tenant.
+	if _, err := CollectMigrations(service, dir, minVersion, maxVersion); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		report = make(TenantReport, len(schemas))
+		jobs   = make(chan int)
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// Checked here rather than when handing out schemas, which
+				// happens while the failing one may still run.
+				mu.Lock()
+				stop := failed && !opts.ContinueOnError
+				mu.Unlock()
+				if stop {
+					report[i] = TenantResult{Schema: schemas[i], Skipped: true}
+					continue
+				}
+				res := runTenant(command, db, sqlDB, searchPath, schemas[i], service, dir, args...)
+				report[i] = res
+				if res.Err != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range schemas {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if n := report.Failed(); n > 0 {
+		return report, fmt.Errorf("%d of %d tenants failed", n, len(report))
+	}
+	return report, nil
+}
+
+// runTenant runs command for one schema on a dedicated connection.
+func runTenant(command string, db *gorm.DB, sqlDB *sql.DB, searchPath SearchPathSetter, schema, service, dir string, args ...string) TenantResult {
+	res := TenantResult{Schema: schema}
+	ctx := db.Statement.Context
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		res.Err = errors.Wrap(err, "failed to get connection")
+		return res
+	}
+	defer conn.Close()
+
+	set, reset := searchPath.SearchPathSQL(schema)
+	if _, err := conn.ExecContext(ctx, set); err != nil {
+		res.Err = errors.Wrap(err, "failed to set search_path")
+		return res
+	}
+	// Don't hand the connection back to the pool with our search_path.
+	defer conn.ExecContext(ctx, reset)
+
+	tdb := bindConn(db, conn)
+
+	logFor(tdb).Printf("goose: tenant %s: %s\n", schema, command)
+	if err := Run(command, tdb, service, dir, args...); err != nil {
+		res.Err = err
+	}
+
+	version, err := appliedVersion(tdb, service)
+	if err != nil && res.Err == nil {
+		res.Err = err
+	}
+	res.Version = version
+	return res
+}
@@ -0,0 +1,189 @@
+package goose
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTenantsFromFile(t *testing.T) {
+	t.Parallel()
+
+	f, err := ioutil.TempFile("", "tenants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name()) // clean up
+
+	if _, err := f.WriteString("# active customers\nacme\n\n  globex  \n# initech\numbrella\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	schemas, err := TenantsFromFile(f.Name())(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"acme", "globex", "umbrella"}; !reflect.DeepEqual(schemas, want) {
+		t.Errorf("unexpected schemas, got %v, want %v", schemas, want)
+	}
+}
+
+func TestTenantReportFailed(t *testing.T) {
+	t.Parallel()
+
+	report := TenantReport{
+		{Schema: "acme", Version: 3},
+		{Schema: "globex", Version: 2, Err: errors.New("boom")},
+		{Schema: "umbrella", Skipped: true},
+	}
+	if n := report.Failed(); n != 2 {
+		t.Errorf("unexpected number of failed tenants, got %v, want 2", n)
+	}
+}
+
+func TestRunTenantsSchema(t *testing.T) {
+	// Changes the version table, so not parallel.
+	SetVersionTable("ops", "goose_db_version")
+	defer SetVersionTable("", "goose_db_version")
+
+	opts := TenantOptions{Tenants: func(*gorm.DB) ([]string, error) { return []string{"acme"}, nil }}
+	_, err := RunTenants("up", openMemoryDB(t), "default", "examples/sql-migrations", opts)
+	if err == nil || !strings.Contains(err.Error(), "can't be in schema ops") {
+		t.Errorf("expected a schema-qualified version table to be refused, got %v", err)
+	}
+}
+
+func TestRunTenantsDialect(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	opts := TenantOptions{Tenants: func(*gorm.DB) ([]string, error) { return []string{"acme"}, nil }}
+	_, err := RunTenants("up", openMemoryDB(t), "default", "examples/sql-migrations", opts)
+	if err == nil || !strings.Contains(err.Error(), "needs a search path") {
+		t.Errorf("expected a dialect without search path to be refused, got %v", err)
+	}
+}
+
+func TestRunTenants(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	RegisterDialect("sqlite3-tenant", &tenantSqliteDialect{})
+	if err := SetDialect("sqlite3-tenant"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_users.sql":  "-- +goose Up\nCREATE TABLE tenant.users (id INTEGER);\n-- +goose Down\nDROP TABLE tenant.users;\n",
+		"00002_orders.sql": "-- +goose Up\nCREATE TABLE tenant.orders (id INTEGER);\n-- +goose Down\nDROP TABLE tenant.orders;\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		name string
+		opts TenantOptions
+		want []string // result of every tenant, in schema order
+	}{
+		{
+			name: "one worker stops after a failure",
+			opts: TenantOptions{Workers: 1},
+			want: []string{"acme 2", "globex failed", "initech skipped", "umbrella skipped"},
+		},
+		{
+			name: "workers continue on error",
+			opts: TenantOptions{Workers: 3, ContinueOnError: true},
+			want: []string{"acme 2", "globex failed", "initech 2", "umbrella 2"},
+		},
+	}
+	for _, test := range tt {
+		// The databases of the tenants live as long as a connection to
+		// them. globex has a users table already, which fails its first
+		// migration.
+		schemas := []string{"umbrella", "globex", "acme", "initech"}
+		tenants := make(map[string]*gorm.DB)
+		for _, schema := range schemas {
+			tenants[schema] = openTenantDB(t, schema)
+		}
+		if r := tenants["globex"].Exec("CREATE TABLE users (id INTEGER)"); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.opts.Tenants = func(*gorm.DB) ([]string, error) { return schemas, nil }
+		report, err := RunTenants("up", db, "default", dir, test.opts)
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%d of 4 tenants failed", report.Failed())) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+
+		var got []string
+		for _, res := range report {
+			switch {
+			case res.Skipped:
+				got = append(got, res.Schema+" skipped")
+			case res.Err != nil:
+				got = append(got, res.Schema+" failed")
+			default:
+				got = append(got, fmt.Sprintf("%s %d", res.Schema, res.Version))
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got results %q, want %q", test.name, got, test.want)
+		}
+
+		// Every tenant keeps its own version table.
+		for _, res := range report {
+			var count int64
+			if err := tenants[res.Schema].Raw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'orders'").Row().Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if migrated := res.Err == nil && !res.Skipped; migrated != (count == 1) {
+				t.Errorf("%s: %s has orders table: %v", test.name, res.Schema, count == 1)
+			}
+		}
+
+		closeDB(db)
+		for _, tdb := range tenants {
+			closeDB(tdb)
+		}
+	}
+}
+
+// openTenantDB opens the in-memory database of schema.
+func openTenantDB(t *testing.T, schema string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(tenantDatabase(schema)), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
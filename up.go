@@ -8,6 +8,9 @@ func UpTo(db *gorm.DB, service, dir string, version int64) error {
 	if err != nil {
 		return err
 	}
+	if err := checkDirty(db, service); err != nil {
+		return err
+	}
 
 	for {
 		current, err := GetDBVersion(db, service)
@@ -18,7 +21,7 @@ func UpTo(db *gorm.DB, service, dir string, version int64) error {
 		next, err := migrations.Next(current)
 		if err != nil {
 			if err == ErrNoNextVersion {
-				log.Printf("goose: no migrations to run. current version: %d\n", current)
+				logFor(db).Printf("goose: no migrations to run. current version: %d\n", current)
 				return nil
 			}
 			return err
@@ -41,6 +44,9 @@ func UpByOne(db *gorm.DB, service, dir string) error {
 	if err != nil {
 		return err
 	}
+	if err := checkDirty(db, service); err != nil {
+		return err
+	}
 
 	currentVersion, err := GetDBVersion(db, service)
 	if err != nil {
@@ -50,7 +56,7 @@ func UpByOne(db *gorm.DB, service, dir string) error {
 	next, err := migrations.Next(currentVersion)
 	if err != nil {
 		if err == ErrNoNextVersion {
-			log.Printf("goose: no migrations to run. current version: %d\n", currentVersion)
+			logFor(db).Printf("goose: no migrations to run. current version: %d\n", currentVersion)
 		}
 		return err
 	}
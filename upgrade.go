@@ -0,0 +1,255 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// VersionTableUpgrade is a step bringing the version table of a dialect to
+// its next meta-version.
+type VersionTableUpgrade struct {
+	// Column added by the step, if any. The step is skipped if the table
+	// has the column already, as tables created before goose tracked
+	// meta-versions may.
+	Column string
+	SQL    []string
+}
+
+// VersionTableUpgrader is implemented by dialects whose version table
+// changed shape over time, most by adding the description, ticket and
+// author columns. Element i of VersionTableUpgrades brings a table of
+// meta-version i to meta-version i+1. CreateVersionTableSQL creates a table
+// of the latest meta-version, len(VersionTableUpgrades(service)). Steps
+// adding the service column record service on the existing rows, which
+// tables without the column only hold for the service goose runs for.
+type VersionTableUpgrader interface {
+	VersionTableUpgrades(service string) []VersionTableUpgrade
+}
+
+// UpgradeLocker is implemented by dialects that keep concurrent goose
+// processes from upgrading the version table at once. UpgradeLockSQL returns
+// the statement locking key, run first in the transaction of every upgrade
+// step, and the statement unlocking it after the transaction, "" if ending
+// the transaction releases the lock. Both run on the same connection.
+type UpgradeLocker interface {
+	UpgradeLockSQL(key string) (lock, unlock string)
+}
+
+// upgradeLockName is the name Locker dialects lock version table upgrades
+// under, which can't be the name of a service.
+const upgradeLockName = "goose:upgrade"
+
+// upgradeLockKey is the key UpgradeLocker dialects lock upgrades of the
+// version table under.
+func upgradeLockKey() string {
+	return upgradeLockName + ":" + TableName()
+}
+
+// addColumnUpgrades returns a step per column adding it with format, which
+// takes the table and the column definition.
+func addColumnUpgrades(format, table string, columns ...string) []VersionTableUpgrade {
+	steps := make([]VersionTableUpgrade, 0, len(columns))
+	for _, column := range columns {
+		steps = append(steps, VersionTableUpgrade{
+			Column: strings.Fields(column)[0],
+			SQL:    []string{fmt.Sprintf(format, table, column)},
+		})
+	}
+	return steps
+}
+
+// versionTableUpgrades returns the upgrade steps of the current dialect for
+// service.
+func versionTableUpgrades(service string) []VersionTableUpgrade {
+	if u, ok := GetDialect().(VersionTableUpgrader); ok {
+		return u.VersionTableUpgrades(service)
+	}
+	return nil
+}
+
+func metaTableName() string {
+	return companionTableName("_meta")
+}
+
+func createMetaTableSQL() string {
+	if c, ok := GetDialect().(CompanionTableCreator); ok {
+		if q := c.CreateMetaTableSQL(metaTableName()); q != "" {
+			return q
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE %s (meta_version INTEGER NOT NULL PRIMARY KEY)", metaTableName())
+}
+
+// metaVersion returns the meta-version of the version table, and false if
+// goose doesn't track it yet.
+func metaVersion(db *gorm.DB) (int, bool) {
+	var v sql.NullInt64
+	q := fmt.Sprintf("SELECT MAX(meta_version) FROM %s", metaTableName())
+	if err := db.Raw(q).Row().Scan(&v); err != nil {
+		return 0, false
+	}
+	return int(v.Int64), true
+}
+
+// setMetaVersion records meta-version v of the version table, creating the
+// meta table if needed.
+func setMetaVersion(db *gorm.DB, v int) error {
+	if _, ok := metaVersion(db); !ok {
+		if r := db.Exec(createMetaTableSQL()); r.Error != nil {
+			return errors.Wrap(r.Error, "failed to create meta table")
+		}
+	}
+	q := fmt.Sprintf("INSERT INTO %s (meta_version) VALUES (?)", metaTableName())
+	if r := db.Exec(q, v); r.Error != nil {
+		return errors.Wrap(r.Error, "failed to record meta-version")
+	}
+	return nil
+}
+
+// hasVersionColumn reports whether the version table has column, or
+// whether it exists at all if column is "*".
+func hasVersionColumn(db *gorm.DB, column string) bool {
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", column, companionTableName(""))
+	rows, err := db.Raw(q).Rows()
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// hasTable reports whether table exists.
+func hasTable(db *gorm.DB, table string) bool {
+	rows, err := db.Raw(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table)).Rows()
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// upgradeVersionTable brings an existing version table to the latest
+// meta-version of the dialect. Each step runs in a transaction, along with
+// recording its meta-version. Dialects implementing Locker hold a lock
+// while upgrading, those implementing UpgradeLocker while running each
+// step. A step that fails because another process applied it concurrently
+// is not an error.
+func upgradeVersionTable(db *gorm.DB, service string) error {
+	steps := versionTableUpgrades(service)
+	current, tracked := metaVersion(db)
+	if current >= len(steps) {
+		return nil
+	}
+	if !tracked && !hasVersionColumn(db, "*") {
+		return nil // created along with its meta-version by EnsureDBVersion
+	}
+	if _, ok := GetDialect().(UpgradeLocker); ok && !boundToConn(db) {
+		// The lock and unlock statements must run on the same connection.
+		return withSession(db, nil, func(db *gorm.DB) error {
+			return upgradeVersionTable(db, service)
+		})
+	}
+
+	if locker, ok := GetDialect().(Locker); ok {
+		if err := locker.Lock(db, upgradeLockName); err != nil {
+			return errors.Wrap(err, "failed to lock version table upgrade")
+		}
+		defer func() {
+			if err := locker.Unlock(db, upgradeLockName); err != nil {
+				logFor(db).Printf("goose: %v\n", err)
+			}
+		}()
+		current, tracked = metaVersion(db)
+	}
+	if !tracked {
+		if err := setMetaVersion(db, current); err != nil {
+			if v, ok := metaVersion(db); !ok || v < current {
+				return err
+			}
+		}
+	}
+
+	for i := current; i < len(steps); i++ {
+		if err := applyVersionTableUpgrade(db, i+1, steps[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyVersionTableUpgrade(db *gorm.DB, target int, step VersionTableUpgrade) error {
+	if v, _ := metaVersion(db); v >= target {
+		return nil
+	}
+	// Checked outside of the transaction, which a failing query aborts on
+	// Postgres.
+	skip := step.Column != "" && hasVersionColumn(db, step.Column)
+
+	tx := db
+	if supportsTx() {
+		if tx = db.Begin(); tx.Error != nil {
+			return errors.Wrap(tx.Error, "failed to begin transaction")
+		}
+	}
+	lock, unlock := "", ""
+	if l, ok := GetDialect().(UpgradeLocker); ok {
+		lock, unlock = l.UpgradeLockSQL(upgradeLockKey())
+	}
+	if unlock != "" {
+		defer func() {
+			if r := db.Exec(unlock); r.Error != nil {
+				logFor(db).Printf("goose: failed to unlock version table upgrade: %v\n", r.Error)
+			}
+		}()
+	}
+	var applied bool // by another process while we waited for the lock
+	err := func() error {
+		if lock != "" {
+			if r := tx.Exec(lock); r.Error != nil {
+				return errors.Wrap(r.Error, "failed to lock version table upgrade")
+			}
+			if v, _ := metaVersion(tx); v >= target {
+				applied = true
+				return nil
+			}
+		}
+		if !skip {
+			for _, statement := range step.SQL {
+				verboseInfo("Upgrading version table: %s", statement)
+				if r := tx.Exec(statement); r.Error != nil {
+					return r.Error
+				}
+			}
+		}
+		q := fmt.Sprintf("INSERT INTO %s (meta_version) VALUES (?)", metaTableName())
+		return tx.Exec(q, target).Error
+	}()
+	if tx != db {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}
+
+	if err != nil {
+		// Another process may have applied the step meanwhile.
+		if v, _ := metaVersion(db); v >= target {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to upgrade version table to meta-version %d", target)
+	}
+	switch {
+	case applied:
+		verboseInfo("Version table upgraded to meta-version %d by another process", target)
+	case skip:
+		verboseInfo("Version table has column %s already, meta-version %d", step.Column, target)
+	default:
+		logFor(db).Printf("goose: upgraded version table to meta-version %d\n", target)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package goose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeVersionTable(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	latest := len(Sqlite3Dialect{}.VersionTableUpgrades("test"))
+
+	tt := []struct {
+		name  string
+		setup []string
+		want  int64
+	}{
+		{
+			name: "fresh",
+			want: 0,
+		},
+		{
+			name: "before metadata columns",
+			setup: []string{
+				`CREATE TABLE goose_db_version (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					version_id INTEGER NOT NULL,
+					is_applied INTEGER NOT NULL,
+					tstamp TIMESTAMP DEFAULT (datetime('now'))
+				)`,
+				"INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (7, 1)",
+			},
+			want: 7,
+		},
+		{
+			name: "before meta-versions",
+			setup: []string{
+				Sqlite3Dialect{}.CreateVersionTableSQL(),
+				"INSERT INTO goose_db_version (version_id, is_applied, description) VALUES (0, 1, NULL), (3, 1, 'kept')",
+			},
+			want: 3,
+		},
+	}
+	for _, test := range tt {
+		db := openMemoryDB(t)
+		for _, statement := range test.setup {
+			if r := db.Exec(statement); r.Error != nil {
+				t.Fatalf("%s: %v", test.name, r.Error)
+			}
+		}
+
+		version, err := EnsureDBVersion(db, "test")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if version != test.want {
+			t.Errorf("%s: got version %d, want %d", test.name, version, test.want)
+		}
+		if v, tracked := metaVersion(db); !tracked || v != latest {
+			t.Errorf("%s: got meta-version %d (tracked: %v), want %d", test.name, v, tracked, latest)
+		}
+		if r := db.Exec(GetDialect().InsertVersionSQL("test"), 8, true, "upgraded", "OPS-1", "jane"); r.Error != nil {
+			t.Errorf("%s: failed to record a version with metadata: %v", test.name, r.Error)
+		}
+
+		// Upgrading again is a no-op.
+		if err := upgradeVersionTable(db, "test"); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestUpgradeServiceColumn(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	RegisterDialect("sqlite3-scoped", &scopedSqliteDialect{})
+	if err := SetDialect("sqlite3-scoped"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// The versions of a table without the service column are those of the
+	// service goose runs for, here not the default one.
+	db := openMemoryDB(t)
+	for _, statement := range []string{
+		`CREATE TABLE goose_db_version (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version_id INTEGER NOT NULL,
+			is_applied INTEGER NOT NULL,
+			tstamp TIMESTAMP DEFAULT (datetime('now'))
+		)`,
+		"INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (7, 1)",
+	} {
+		if r := db.Exec(statement); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	version, err := EnsureDBVersion(db, "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 7 {
+		t.Errorf("got version %d, want 7", version)
+	}
+	var services []string
+	if r := db.Raw("SELECT DISTINCT service FROM goose_db_version").Scan(&services); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if !reflect.DeepEqual(services, []string{"billing"}) {
+		t.Errorf("got services %q, want billing", services)
+	}
+
+	// The SQL Server and ClickHouse upgrades fill in the service too.
+	for _, d := range []VersionTableUpgrader{SqlServerDialect{}, ClickHouseDialect{}} {
+		steps := d.VersionTableUpgrades("it's")
+		var sql string
+		for _, step := range steps {
+			if step.Column == "service" {
+				sql = strings.Join(step.SQL, "\n")
+			}
+		}
+		if !strings.Contains(sql, "DEFAULT N'it''s'") && !strings.Contains(sql, `DEFAULT 'it\'s'`) {
+			t.Errorf("%T: service column not filled with the service: %q", d, sql)
+		}
+	}
+}
+
+func TestUpgradeLock(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	dialect = lockingSqliteDialect{}
+
+	db := openMemoryDB(t)
+	for _, statement := range []string{
+		"CREATE TABLE upgrade_locks (id INTEGER PRIMARY KEY AUTOINCREMENT, event TEXT NOT NULL)",
+		`CREATE TABLE goose_db_version (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version_id INTEGER NOT NULL,
+			is_applied INTEGER NOT NULL,
+			tstamp TIMESTAMP DEFAULT (datetime('now'))
+		)`,
+		"INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1)",
+	} {
+		if r := db.Exec(statement); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	if _, err := EnsureDBVersion(db, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	if r := db.Raw("SELECT event FROM upgrade_locks ORDER BY id").Scan(&events); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	var want []string
+	for range (Sqlite3Dialect{}).VersionTableUpgrades("test") {
+		want = append(want, "lock goose:upgrade:goose_db_version", "unlock")
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got lock events %q, want %q", events, want)
+	}
+}
+
+func TestUpgradeLockSQL(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		dialect      UpgradeLocker
+		lock, unlock string
+	}{
+		{PostgresDialect{}, "pg_advisory_xact_lock(hashtext('goose:upgrade:it''s'))", ""},
+		{MySQLDialect{}, "GET_LOCK(SHA1('goose:upgrade:it''s'), -1)", "RELEASE_LOCK(SHA1('goose:upgrade:it''s'))"},
+		{SqlServerDialect{}, "sp_getapplock @Resource = N'goose:upgrade:it''s', @LockMode = 'Exclusive', @LockOwner = 'Transaction'", ""},
+	}
+	for _, test := range tt {
+		lock, unlock := test.dialect.UpgradeLockSQL("goose:upgrade:it's")
+		if !strings.Contains(lock, test.lock) {
+			t.Errorf("%T: unexpected lock SQL %s", test.dialect, lock)
+		}
+		if !strings.Contains(unlock, test.unlock) || (test.unlock == "") != (unlock == "") {
+			t.Errorf("%T: unexpected unlock SQL %q", test.dialect, unlock)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package goose
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ValidationError is a problem found in a migration by Validate.
+type ValidationError struct {
+	File string
+	Line int // 0 if the problem is not tied to a line
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.File == "":
+		return e.Err.Error()
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	default:
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+}
+
+// ValidationErrors is the list of problems returned by Validate.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d problem(s) found:", len(e)))
+	for _, err := range e {
+		lines = append(lines, "    "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks the migrations of a service without connecting to the
+// database. It collects every problem rather than stopping at the first:
+// invalid or duplicate versions, SQL files that fail to parse in either
+// direction, missing Down sections, unbalanced StatementBegin/StatementEnd
+// annotations, Go files without registered functions and registrations
+// whose file is missing from dir. The returned error is a ValidationErrors
+// if any problem was found.
+func Validate(service, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("%s directory does not exist", dir)
+	}
+
+	var problems ValidationErrors
+	report := func(file string, line int, err error) {
+		problems = append(problems, &ValidationError{File: file, Line: line, Err: err})
+	}
+
+	for _, err := range registrationErrorsByService[service] {
+		report("", 0, err)
+	}
+
+	versions := make(map[int64][]string)
+
+	sqlFiles, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	for _, file := range sqlFiles {
+		v, err := NumericComponent(file)
+		if err != nil {
+			report(file, 0, errors.Wrap(err, "invalid version prefix"))
+			continue
+		}
+		versions[v] = append(versions[v], file)
+
+		problems = append(problems, validateSQLFile(file)...)
+	}
+
+	registered := registeredGoMigrationsByService[service]
+	goFiles, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	goFilesByBase := make(map[string]bool)
+	for _, file := range goFiles {
+		base := filepath.Base(file)
+		if strings.HasSuffix(base, "_test.go") || !startsWithDigit(base) {
+			continue // not a migration, e.g. main.go
+		}
+		goFilesByBase[base] = true
+
+		v, err := NumericComponent(file)
+		if err != nil {
+			report(file, 0, errors.Wrap(err, "invalid version prefix"))
+			continue
+		}
+		if m, ok := registered[v]; !ok || filepath.Base(m.Source) != base {
+			report(file, 0, errors.Errorf("no Go functions registered for version %d of service %q", v, service))
+			versions[v] = append(versions[v], file)
+		}
+	}
+
+	for v, m := range registered {
+		versions[v] = append(versions[v], m.Source)
+		if !goFilesByBase[filepath.Base(m.Source)] {
+			report(m.Source, 0, errors.Errorf("registered migration has no file in %s", dir))
+		}
+	}
+
+	for v, files := range versions {
+		if len(files) < 2 {
+			continue
+		}
+		sort.Strings(files)
+		for _, file := range files[1:] {
+			report(file, 0, errors.Errorf("duplicate version %d, also used by %s", v, files[0]))
+		}
+	}
+
+	if len(problems) == 0 {
+		log.Printf("goose: no problems found in %s\n", dir)
+		return nil
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// validateSQLFile checks the annotations of a SQL migration and that it
+// parses in both directions.
+func validateSQLFile(file string) ValidationErrors {
+	var problems ValidationErrors
+	report := func(line int, err error) {
+		problems = append(problems, &ValidationError{File: file, Line: line, Err: err})
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		report(0, err)
+		return problems
+	}
+	defer f.Close()
+
+	var (
+		hasDown bool
+		begin   int // line of the open StatementBegin, 0 if none
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), scanBufSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "--") {
+			continue
+		}
+		switch strings.TrimSpace(strings.TrimPrefix(line, "--")) {
+		case "+goose Down":
+			hasDown = true
+			if begin != 0 {
+				report(begin, errors.New("'-- +goose StatementBegin' is not closed before '-- +goose Down'"))
+				begin = 0
+			}
+		case "+goose StatementBegin":
+			if begin != 0 {
+				report(begin, errors.New("'-- +goose StatementBegin' is not closed before the next StatementBegin"))
+			}
+			begin = n
+		case "+goose StatementEnd":
+			if begin == 0 {
+				report(n, errors.New("'-- +goose StatementEnd' without '-- +goose StatementBegin'"))
+			}
+			begin = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		report(0, err)
+		return problems
+	}
+	if begin != 0 {
+		report(begin, errors.New("missing '-- +goose StatementEnd' annotation"))
+	}
+	if !hasDown {
+		report(0, errors.New("missing '-- +goose Down' section"))
+	}
+	if len(problems) > 0 {
+		// The parser would only repeat the annotation problems.
+		return problems
+	}
+
+	for _, direction := range []bool{true, false} {
+		if _, err := f.Seek(0, 0); err != nil {
+			report(0, err)
+			break
+		}
+		if _, _, err := parseSQLMigration(f, direction); err != nil {
+			name := "down"
+			if direction {
+				name = "up"
+			}
+			report(sqlLine(err), errors.Wrap(err, name))
+		}
+	}
+	if _, err := f.Seek(0, 0); err == nil {
+		if _, err := parseSQLOptions(f); err != nil {
+			report(0, err)
+		}
+	}
+
+	return problems
+}
+
+// CheckDialects parses every SQL migration in dir in both directions once
+// for each of dialects, so migrations with Dialect sections are known to
+// work with all of them. The returned error is a ValidationErrors listing
+// the files that fail, if any.
+func CheckDialects(dir string, dialects []string) error {
+	if len(dialects) == 0 {
+		return errors.New("no dialects to check")
+	}
+	for _, name := range dialects {
+		if _, ok := lookupDialect(name); !ok {
+			return errors.Errorf("%q: unknown dialect", name)
+		}
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("%s directory does not exist", dir)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	var problems ValidationErrors
+	for _, file := range files {
+		for _, name := range dialects {
+			for _, direction := range []bool{true, false} {
+				if err := checkDialect(file, name, direction); err != nil {
+					problems = append(problems, &ValidationError{File: file, Line: sqlLine(err), Err: err})
+					break // the other direction usually fails the same way
+				}
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		log.Printf("goose: %d file(s) parse for %s\n", len(files), strings.Join(dialects, ", "))
+		return nil
+	}
+	return problems
+}
+
+// checkDialect parses one direction of file for dialect.
+func checkDialect(file, dialect string, direction bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, _, err := parseSQLStatementsFor(f, direction, dialect); err != nil {
+		name := "down"
+		if direction {
+			name = "up"
+		}
+		return errors.Wrapf(err, "%s: %s", dialect, name)
+	}
+	return nil
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && unicode.IsDigit(rune(s[0]))
+}
@@ -0,0 +1,139 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	files := map[string]string{
+		"00001_create_users.sql":   "-- +goose Up\nCREATE TABLE users (id int);\n-- +goose Down\nDROP TABLE users;\n",
+		"00002_no_down.sql":        "-- +goose Up\nCREATE TABLE posts (id int);\n",
+		"00003_no_end.sql":         "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n-- +goose Down\nSELECT 2;\n",
+		"00003_duplicate.sql":      "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"00004_unfinished.sql":     "-- +goose Up\nSELECT 1;\n-- +goose Down\nDROP TABLE users\n",
+		"abc_bad_prefix.sql":       "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"00005_unregistered.go":    "package migrations\n",
+		"00006_registered.go":      "package migrations\n",
+		"main.go":                  "package main\n",
+		"00007_stray_end.sql":      "-- +goose Up\nSELECT 1;\n-- +goose StatementEnd\n-- +goose Down\nSELECT 1;\n",
+		"00008_bad_requires.sql":   "-- +goose Requires: accounts > 1\n-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"00009_valid_requires.sql": "-- +goose Requires: accounts >= 1\n-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := "validate-test"
+	if err := AddNamedMigration(service, filepath.Join(dir, "00006_registered.go"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddNamedMigration(service, "/elsewhere/00010_missing.go", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddNamedMigration(service, "/elsewhere/00010_conflict.go", nil, nil); err == nil {
+		t.Fatal("expected version conflict error")
+	}
+
+	err = Validate(service, dir)
+	problems, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		"version conflicts with",
+		"00002_no_down.sql: missing '-- +goose Down' section",
+		"00003_no_end.sql: duplicate version 3, also used by",
+		"00003_no_end.sql:2: '-- +goose StatementBegin' is not closed",
+		"00004_unfinished.sql:4: down: failed to parse migration",
+		"00005_unregistered.go: no Go functions registered for version 5",
+		"00007_stray_end.sql:3: '-- +goose StatementEnd' without",
+		"00008_bad_requires.sql: invalid requirement",
+		"/elsewhere/00010_missing.go: registered migration has no file",
+		"abc_bad_prefix.sql: invalid version prefix",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(want), len(problems), err)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("expected problem %q in:\n%v", w, err)
+		}
+	}
+}
+
+func TestValidateDialect(t *testing.T) {
+	// Changes the dialect, so not parallel.
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	migration := "-- +goose Up\nCREATE PROCEDURE p AS SELECT 1\nGO\n-- +goose Down\nDROP PROCEDURE p\nGO\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_procedure.sql"), []byte(migration), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// GO only separates batches on SQL Server.
+	if err := Validate("validate-dialect-test", dir); err == nil || !strings.Contains(err.Error(), "missing semicolon") {
+		t.Fatalf("expected the postgres parser to reject the GO batches, got %v", err)
+	}
+	if err := SetDialect("mssql"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	if err := Validate("validate-dialect-test", dir); err != nil {
+		t.Fatalf("expected the GO batches to be valid on mssql, got %v", err)
+	}
+}
+
+func TestCheckDialects(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_post.sql": dialectSections,
+		// Without a Dialect section, the sqlite3 lexer reads the dollar
+		// quotes as part of the statement and the apostrophe as a quote.
+		"00002_func.sql": "-- +goose Up\nCREATE FUNCTION f() RETURNS text AS $$ SELECT $q$it's$q$ $$ LANGUAGE sql;\n-- +goose Down\nDROP FUNCTION f;\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CheckDialects(dir, []string{"postgres"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckDialects(dir, []string{"no-such-dialect"}); err == nil {
+		t.Fatal("expected an error for an unknown dialect")
+	}
+
+	err = CheckDialects(dir, []string{"postgres", "sqlite3"})
+	problems, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), "00002_func.sql:2: sqlite3: up: ") {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
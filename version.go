@@ -1,6 +1,11 @@
 package goose
 
-import "gorm.io/gorm"
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
 
 // Version prints the current version of the database.
 func Version(db *gorm.DB, service, dir string) error {
@@ -9,18 +14,167 @@ func Version(db *gorm.DB, service, dir string) error {
 		return err
 	}
 
-	log.Printf("goose: service %s version %v\n", service, current)
+	logFor(db).Printf("goose: service %s version %v\n", service, current)
+
+	dirty, err := GetDirtyState(db, service)
+	if err != nil {
+		return err
+	}
+	if dirty != nil {
+		logFor(db).Printf("goose: service %s %s\n", service, dirty)
+	}
 	return nil
 }
 
-var tableName = "goose_db_version"
+var (
+	tableSchema  = ""
+	tableName    = "goose_db_version"
+	createSchema = false
+)
 
-// TableName returns goose db version table name
+// TableName returns goose db version table name, qualified with its schema
+// if it has one. The name is not quoted; dialects use QuotedTableName in
+// SQL.
 func TableName() string {
-	return tableName
+	if tableSchema == "" {
+		return tableName
+	}
+	return tableSchema + "." + tableName
 }
 
-// SetTableName set goose db version table name
+// SetTableName set goose db version table name. A qualified name, like
+// "ops.goose_db_version" or "[ops].[goose_db_version]", sets the schema as
+// well; use SetVersionTable for names containing dots.
 func SetTableName(n string) {
-	tableName = n
+	open, close := '"', '"'
+	switch {
+	case strings.ContainsRune(n, '['):
+		open, close = '[', ']'
+	case strings.ContainsRune(n, '`'):
+		open, close = '`', '`'
+	}
+	parts := splitQualifiedName(n, open, close)
+	last := len(parts) - 1
+	SetVersionTable(strings.Join(parts[:last], "."), parts[last])
+}
+
+// splitQualifiedName splits a dotted name into its parts, ignoring dots
+// between the open and close quote characters. The quotes are removed.
+func splitQualifiedName(name string, open, close rune) []string {
+	var (
+		parts  []string
+		part   strings.Builder
+		quoted bool
+	)
+	runes := []rune(name)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case !quoted && r == open:
+			quoted = true
+		case quoted && r == close:
+			if i+1 < len(runes) && runes[i+1] == close {
+				part.WriteRune(close) // escaped close quote
+				i++
+				continue
+			}
+			quoted = false
+		case !quoted && r == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	return append(parts, part.String())
+}
+
+// SetVersionTable sets the schema and the name of the version table, taken
+// verbatim and quoted by the dialect. The schema is the database on MySQL,
+// TiDB and ClickHouse; an empty schema is the default of the connection.
+func SetVersionTable(schema, table string) {
+	tableSchema, tableName = schema, table
+}
+
+// VersionTable returns the schema and the name of the version table.
+func VersionTable() (schema, table string) {
+	return tableSchema, tableName
+}
+
+// SetCreateSchema makes goose create the schema of the version table, if
+// it doesn't exist, along with the table. The dialect must implement
+// SchemaCreator.
+func SetCreateSchema(create bool) {
+	createSchema = create
+}
+
+// QuotedTableName returns the version table name for use in SQL of the
+// current dialect, qualified with its schema and quoted.
+func QuotedTableName() string {
+	return companionTableName("")
+}
+
+// quoteIdentifier quotes name in double quotes, as standard SQL does.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quotedTableName returns the version table name followed by suffix,
+// qualified with its schema and quoted with quote.
+func quotedTableName(quote func(string) string, suffix string) string {
+	name := quote(tableName + suffix)
+	if tableSchema != "" {
+		name = quote(tableSchema) + "." + name
+	}
+	return name
+}
+
+// companionTableName returns the name of a table goose keeps next to the
+// version table, named after it with suffix, quoted for the current
+// dialect.
+func companionTableName(suffix string) string {
+	quote := quoteIdentifier
+	if q, ok := GetDialect().(IdentifierQuoter); ok {
+		quote = q.QuoteIdentifier
+	}
+	return quotedTableName(quote, suffix)
+}
+
+// checkFoldedTableName fails if the version table is about to be created
+// while an older goose created it under the name folded to lower case.
+// Older releases didn't quote the name, so Postgres, Redshift and
+// CockroachDB folded a table name like GooseVersions to gooseversions.
+func checkFoldedTableName(db *gorm.DB) error {
+	if f, ok := GetDialect().(NameFolder); !ok || !f.FoldsUnquotedNames() {
+		return nil
+	}
+	schema, table := strings.ToLower(tableSchema), strings.ToLower(tableName)
+	if schema == tableSchema && table == tableName {
+		return nil
+	}
+	folded := quoteIdentifier(table)
+	if schema != "" {
+		folded = quoteIdentifier(schema) + "." + folded
+	}
+	if !hasTable(db, folded) {
+		return nil
+	}
+	return errors.Errorf("version table %s doesn't exist, but %s does: goose now quotes the table name, which older releases folded to lower case; rename the table with ALTER TABLE %s RENAME TO %s, or set the lower-cased name",
+		QuotedTableName(), folded, folded, quoteIdentifier(tableName))
+}
+
+// createVersionSchema creates the schema of the version table if asked to.
+func createVersionSchema(db *gorm.DB) error {
+	if !createSchema || tableSchema == "" {
+		return nil
+	}
+	c, ok := GetDialect().(SchemaCreator)
+	if !ok {
+		return errors.Errorf("%q: dialect can't create schemas", dialectName)
+	}
+	verboseInfo("Creating schema %s", tableSchema)
+	if r := db.Exec(c.CreateSchemaSQL(tableSchema)); r.Error != nil {
+		return errors.Wrapf(r.Error, "failed to create schema %s", tableSchema)
+	}
+	return nil
 }